@@ -1,6 +1,12 @@
 package main
 
 import (
+	"context"
+	"embed"
+	"io/fs"
+	"os"
+	"time"
+
 	"github.com/Shoowa/vamos/config"
 	"github.com/Shoowa/vamos/data/cache"
 	"github.com/Shoowa/vamos/data/rdbms"
@@ -12,51 +18,129 @@ import (
 	"_example/routes"
 )
 
-const DB_FIRST = 0
+const (
+	RELOAD_INTERVAL = time.Second * 5
+)
+
+// migrations are compiled into the executable.
+//
+//go:embed sqlc/migrations/first/*.sql
+var migrations embed.FS
 
 func main() {
 	// Read configuration file. Read OPENBAO_TOKEN.
-	cfg := config.Read()
+	cfg, cfgErr := config.Read()
+	if cfgErr != nil {
+		panic(cfgErr)
+	}
 	cfg.Secrets.Openbao.ReadToken()
 
 	// Create a structured JSON logger.
 	logger := logging.CreateLogger(cfg)
 
-	// Connect to Postgres server. The ConnectDB func builds its own copy of the
-	// Openbao client and assigns it to a Postgres "BeforeConnect" func to
-	// re-use whenever a password changes.
-	db1, db1Err := rdbms.ConnectDB(cfg, DB_FIRST)
-	if db1Err != nil {
-		logger.Error(db1Err.Error())
-		panic(db1Err)
-	}
-	defer db1.Close()
-
 	// Create Openbao client inside the custom SkeletonKey. The former reads
 	// secrets from an Openbao server, and the latter offers convenient methods
 	// to work with those secrets.
 	secretsReader := new(secrets.SkeletonKey)
 	secretsReader.Create(cfg)
 
+	// Renew the Openbao token before it expires, and log in again when it
+	// can't be renewed any further.
+	go secretsReader.WatchAuth(context.Background(), logger)
+
+	// Check the watched KV documents for new versions, so that a rotated
+	// password or certificate is adopted without a restart.
+	go secretsReader.PollSecrets(context.Background(), logger)
+
+	// Replace any bao:// references in the config with values read from
+	// Openbao.
+	refErr := cfg.ResolveRefs(secretsReader.Resolvers())
+	if refErr != nil {
+		panic(refErr)
+	}
+
+	// Watch the config files and SIGHUP. The log level, rate limiter, CORF
+	// origins, and health thresholds adopt any valid changes without a restart.
+	watcher, watchErr := config.NewWatcher(cfg, logger)
+	if watchErr != nil {
+		panic(watchErr)
+	}
+	watcher.UseResolvers(secretsReader.Resolvers())
+	watcher.Subscribe(logging.SetLevel)
+	go watcher.Watch(context.Background(), RELOAD_INTERVAL)
+
+	// Connect to every Postgres server in data.relational. The ConnectDB func
+	// assigns the shared SkeletonKey to a Postgres "BeforeConnect" func to read
+	// the password whenever a connection opens. The password is cached for a
+	// short while. Find a pool by name with registry.Get.
+	registry, registryErr := rdbms.OpenRegistry(cfg, secretsReader)
+	if registryErr != nil {
+		logger.Error(registryErr.Error())
+		panic(registryErr)
+	}
+	defer registry.Close()
+
+	// Apply pending migrations to the first database. An advisory lock lets
+	// only one replica of the service migrate at a time. The subcommand
+	// "migrate" offers status, up, and down instead of starting the server.
+	migrationFiles, _ := fs.Sub(migrations, "sqlc/migrations/first")
+	migrator, migratorErr := rdbms.NewMigrator(registry.Default(), migrationFiles, rdbms.WithMigrationLogger(logger))
+	if migratorErr != nil {
+		panic(migratorErr)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		cmdErr := rdbms.MigrateCommand(context.Background(), migrator, os.Args[2:], os.Stdout)
+		if cmdErr != nil {
+			panic(cmdErr)
+		}
+		return
+	}
+	_, migrateErr := migrator.Migrate(context.Background(), rdbms.MIGRATE_LATEST)
+	if migrateErr != nil {
+		logger.Error(migrateErr.Error())
+		panic(migrateErr)
+	}
+
 	// Create a Redis client. The Openbao client reads x509 data from the
 	// Openbao server, and the SkeletonKey assembles it into a working TLS
 	// configuration.
-	cache, cacheErr := cache.CreateClient(cfg, secretsReader)
+	rdb, cacheErr := cache.CreateClient(cfg, secretsReader)
 	if cacheErr != nil {
 		panic(cacheErr.Error())
 	}
-	defer cache.Close()
+	defer cache.Close(rdb)
 
 	// Create a child logger intended for the http.Server.
 	srvLogger := logger.WithGroup("server")
 
 	// Dependency wrapping happens here. Backbone holds pointers to a logger, a
-	// Postgres connection pool, and a Redis client.
-	backbone := router.NewBackbone(
+	// Registry of Postgres pools, and a Redis client.
+	options := []router.Option{
 		router.WithLogger(srvLogger),
-		router.WithDbHandle(db1),
-		router.WithCache(cache),
-	)
+		router.WithDatabases(registry),
+		router.WithCache(rdb),
+		router.WithWatcher(watcher),
+		router.WithHealthCheck("openbao_auth", secretsReader.AuthHealthy),
+	}
+
+	// Read the x509 certificate & key from the source declared in
+	// httpserver.tls_server, e.g., Openbao or local files. The CertManager
+	// replaces the certificate before it expires, and the health check fails
+	// when a replacement can't be obtained in time. The plaintext & h2c modes
+	// serve without one.
+	var certs *server.CertManager
+	if cfg.HttpServer.Mode == config.MODE_TLS || cfg.HttpServer.Mode == config.MODE_MTLS {
+		var certsErr error
+		certs, certsErr = server.NewCertManager(cfg.HttpServer, secretsReader, srvLogger)
+		if certsErr != nil {
+			logger.Error(certsErr.Error())
+			panic(certsErr)
+		}
+		go certs.Run(context.Background())
+		options = append(options, router.WithHealthCheck("tls_certificate", certs.Healthy))
+	}
+
+	backbone := router.NewBackbone(options...)
 
 	// In your executable, wrap the library Backbone with a native struct that
 	// has its own HTTP Handlers. Wrap the wrapping. This secondary wrapper will
@@ -68,16 +152,12 @@ func main() {
 	// interface method GetEndpoints to add paths & handlers to a router.
 	appRouter := router.NewRouter(cfg, backboneWrapper)
 
-	// Read x509 certificate & key for this server to secure connections with
-	// clients.
-	X509, X509Err := secretsReader.ReadTlsCertAndKey(cfg.HttpServer.TlsServer)
-	if X509Err != nil {
-		logger.Error(X509Err.Error())
-		panic(X509Err)
-	}
-
 	// Create a webserver with a router, an Error logger, and TLS configuration.
-	webserver := server.NewServer(cfg, appRouter, X509, srvLogger)
+	webserver, srvErr := server.NewServer(cfg, appRouter, certs, srvLogger)
+	if srvErr != nil {
+		logger.Error(srvErr.Error())
+		panic(srvErr)
+	}
 
 	// Activate webserver gracefully, and await any termination signals. The
 	// original logger will record any shutdown errors.
@@ -12,6 +12,7 @@ import (
 
 	"github.com/Shoowa/vamos/config"
 	"github.com/Shoowa/vamos/data/rdbms"
+	"github.com/Shoowa/vamos/secrets"
 	. "github.com/Shoowa/vamos/testhelper"
 )
 
@@ -41,10 +42,13 @@ func TestMain(m *testing.M) {
 func Test_ConnectDB(t *testing.T) {
 	t.Setenv("APP_ENV", "DEV")
 	t.Setenv("OPENBAO_TOKEN", "token")
-	cfg := config.Read()
-	db, dbErr := rdbms.ConnectDB(cfg, cfg.Test.DbPosition)
+	cfg, cfgErr := config.Read()
+	Ok(t, cfgErr)
+	sk := new(secrets.SkeletonKey)
+	sk.Create(cfg)
+	db, dbErr := rdbms.ConnectDB(cfg, sk, cfg.Test.DbPosition)
 	Ok(t, dbErr)
-	t.Cleanup(func() { db.Close() })
+	t.Cleanup(func() { rdbms.Close(db) })
 }
 
 // Second, test reading data concurrently.
@@ -52,8 +56,11 @@ func Test_ReadingData(t *testing.T) {
 	t.Setenv("APP_ENV", "DEV")
 	t.Setenv("OPENBAO_TOKEN", "token")
 
-	cfg := config.Read()
-	db, _ := rdbms.ConnectDB(cfg, cfg.Test.DbPosition)
+	cfg, cfgErr := config.Read()
+	Ok(t, cfgErr)
+	sk := new(secrets.SkeletonKey)
+	sk.Create(cfg)
+	db, _ := rdbms.ConnectDB(cfg, sk, cfg.Test.DbPosition)
 	q := first.New(db)
 
 	timer, _ := context.WithTimeout(context.Background(), TIMEOUT_READ)
@@ -74,7 +81,7 @@ func Test_ReadingData(t *testing.T) {
 		readMostProductiveAuthorAndBook(t, q, timer)
 	})
 
-	t.Cleanup(func() { db.Close() })
+	t.Cleanup(func() { rdbms.Close(db) })
 }
 
 func readOneAuthor(t *testing.T, q *first.Queries, ctx context.Context) {
@@ -1,51 +1,138 @@
 package config
 
 import (
+	"bytes"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
 	"strings"
 )
 
 // AppVersion can be defined during the build command. It will appear in logs.
 var AppVersion string
 
-// Read from either the dev or prod file.
-func Read() *Config {
-	eFile := "config/prod.json"
-	if os.Getenv("APP_ENV") == "DEV" {
-		eFile = "config/dev.json"
+// Read loads the layered config files chosen by the environ. See Files.
+func Read() (*Config, error) {
+	paths, pathsErr := Files()
+	if pathsErr != nil {
+		return nil, pathsErr
 	}
+	return LoadFiles(paths...)
+}
 
-	jsonFile, errFile := os.ReadFile(eFile)
-	if errFile != nil {
-		dirName := os.Getenv("PROJECT_NAME")
-		if dirName != "" {
-			os.Setenv("APP_ENV", "DEV")
-			wd, _ := os.Getwd()
-			for !strings.HasSuffix(wd, dirName) {
-				wd = filepath.Dir(wd)
-			}
-			chdirErr := os.Chdir(wd)
-			if chdirErr != nil {
-				panic(chdirErr.Error())
-			}
-			jsonFile, errFile = os.ReadFile("config/dev.json")
-		}
+// Load reads a single JSON file, overlays any VAMOS_ environ variables, then
+// validates every section of the resulting Config. All problems found during
+// validation are reported together in a single ValidationError.
+func Load(path string) (*Config, error) {
+	return LoadFiles(path)
+}
+
+// LoadFiles deep-merges JSON files in the given order, so a later file
+// overrides an earlier one. Then it overlays any VAMOS_ environ variables,
+// resolves env:// and file:// references, and validates every section of the
+// resulting Config.
+func LoadFiles(paths ...string) (*Config, error) {
+	merged := map[string]any{}
+	for _, path := range paths {
+		jsonFile, errFile := os.ReadFile(path)
 		if errFile != nil {
-			panic("No config file!")
+			return nil, fmt.Errorf("config: %w", errFile)
 		}
+
+		// Preserve numbers exactly as written while they pass through a map.
+		layer := map[string]any{}
+		decoder := json.NewDecoder(bytes.NewReader(jsonFile))
+		decoder.UseNumber()
+		err := decoder.Decode(&layer)
+		if err != nil {
+			return nil, fmt.Errorf("config: parsing %v: %w", path, err)
+		}
+		merge(merged, layer)
+	}
+
+	// Decode the merged document through JSON, so that tags are respected.
+	doc, docErr := json.Marshal(merged)
+	if docErr != nil {
+		return nil, fmt.Errorf("config: %w", docErr)
 	}
 
 	var config Config
-	err := json.Unmarshal(jsonFile, &config)
+	err := json.Unmarshal(doc, &config)
 	if err != nil {
-		panic(err.Error())
+		return nil, fmt.Errorf("config: parsing %v: %w", strings.Join(paths, ", "), err)
+	}
+
+	envErr := config.ApplyEnv()
+	if envErr != nil {
+		return nil, envErr
+	}
+
+	refErr := config.ResolveRefs(DefaultResolvers())
+	if refErr != nil {
+		return nil, refErr
+	}
+
+	config.setDefaults()
+
+	validationErr := config.Validate()
+	if validationErr != nil {
+		return nil, validationErr
 	}
 
 	config.Version = AppVersion
-	return &config
+	return &config, nil
+}
+
+// setDefaults fills blank values that can be inferred.
+func (c *Config) setDefaults() {
+	if c.Data != nil {
+		for i := range c.Data.Relational {
+			db := &c.Data.Relational[i]
+			if db.Name == "" {
+				db.Name = db.Database
+			}
+			if db.Role == ROLE_PRIMARY && db.Cluster == "" {
+				db.Cluster = db.Name
+			}
+			if db.CredsRole != "" && db.CredsMount == "" {
+				db.CredsMount = "database"
+			}
+		}
+	}
+	if c.Secrets != nil {
+		if c.Secrets.Provider == "" {
+			c.Secrets.Provider = PROVIDER_OPENBAO
+		}
+		c.Secrets.Openbao.TlsClient.defaultSource(TLS_FILE)
+		if c.Secrets.Openbao.Auth == nil {
+			c.Secrets.Openbao.Auth = &OpenbaoAuth{}
+		}
+		auth := c.Secrets.Openbao.Auth
+		if auth.Method == "" {
+			auth.Method = AUTH_TOKEN
+		}
+		if auth.Mount == "" {
+			auth.Mount = auth.Method
+		}
+		if auth.Method == AUTH_KUBERNETES && auth.JwtPath == "" {
+			auth.JwtPath = K8S_JWT_PATH
+		}
+	}
+	if c.HttpServer != nil {
+		if c.HttpServer.Mode == "" {
+			c.HttpServer.Mode = MODE_TLS
+		}
+		if c.HttpServer.Mode == MODE_MTLS {
+			c.HttpServer.ClientAuth = CLIENT_AUTH_REQUIRE
+		}
+		if c.HttpServer.MinTlsVersion == "" {
+			c.HttpServer.MinTlsVersion = "1.3"
+		}
+		c.HttpServer.TlsServer.defaultSource(TLS_OPENBAO_KV)
+		c.HttpServer.TlsClient.defaultSource(TLS_OPENBAO_KV)
+	}
 }
 
 // Config holds various smaller structs needed to define desired behavior in the
@@ -68,12 +155,32 @@ type Logger struct {
 	Debug bool `json:"debug"`
 }
 
-// Secrets is currently oriented toward Openbao.
+// Secrets declares the provider of secrets. Openbao is the default, while the
+// dir & env providers let an application run without Openbao.
 type Secrets struct {
+	// Provider is one of openbao, dir, or env. Blank means openbao.
+	Provider string `json:"provider"`
+	// Dir is the root directory read by the dir provider, e.g., the mount of
+	// Kubernetes secrets.
+	Dir string `json:"dir"`
+	// EnvPrefix is prepended to the names of environ variables read by the env
+	// provider.
+	EnvPrefix string `json:"env_prefix"`
 	// An Openbao struct containing a TlsSecret struct.
 	Openbao Openbao `json:"openbao"`
 }
 
+// Providers of secrets.
+const (
+	// PROVIDER_OPENBAO reads secrets from Openbao.
+	PROVIDER_OPENBAO = "openbao"
+	// PROVIDER_DIR reads a file per key from a directory, e.g., Kubernetes
+	// secrets mounted as a volume.
+	PROVIDER_DIR = "dir"
+	// PROVIDER_ENV reads environ variables.
+	PROVIDER_ENV = "env"
+)
+
 // Openbao struct expects an OPENBAO_TOKEN value, a site, and TLS config.
 type Openbao struct {
 	// Token can obtain a value by invoking the ReadToken method.
@@ -81,8 +188,78 @@ type Openbao struct {
 	Scheme string `json:"scheme"`
 	Host   string `json:"host"`
 	Port   string `json:"port"`
-	// TlsSecret expects local file paths when used inside the Openbao struct.
+	// TlsClient must be a file or inline source, because Openbao can't supply
+	// the material needed to contact itself.
 	TlsClient *TlsSecret `json:"tls_client"`
+	// Auth chooses how the Openbao client obtains a token. When absent, the
+	// token is read from OPENBAO_TOKEN.
+	Auth *OpenbaoAuth `json:"auth"`
+	// CacheTtl is the amount of seconds a value read from the KV engine is
+	// re-used. Zero adopts a default of 30 seconds, and a negative value
+	// disables the cache.
+	CacheTtl int `json:"cache_ttl"`
+	// Timeout is the amount of seconds a single call to Openbao may take,
+	// including retries. Defaults to 5 seconds.
+	Timeout int `json:"timeout"`
+	// MaxRetries is how often a request failing with a 5xx status or a
+	// connection error is retried with backoff. Zero keeps the default of 2,
+	// and a negative value disables retries.
+	MaxRetries int `json:"max_retries"`
+	// KvMount is the default mount of the KV engine. Defaults to secret.
+	KvMount string `json:"kv_mount"`
+	// KvV1Mounts lists the mounts that hold a KV v1 engine. Every other mount
+	// is read as KV v2.
+	KvV1Mounts []string `json:"kv_v1_mounts"`
+	// PollInterval is the amount of seconds between checks of watched KV
+	// documents for a new version. Zero adopts a default of 30 seconds, and a
+	// negative value disables polling.
+	PollInterval int `json:"poll_interval"`
+}
+
+// Openbao authentication methods.
+const (
+	// AUTH_TOKEN reads a token from the environ variable OPENBAO_TOKEN.
+	AUTH_TOKEN = "token"
+	// AUTH_TOKEN_FILE reads a token from a file, e.g., the sink of an Openbao
+	// agent. The file is read again whenever it changes.
+	AUTH_TOKEN_FILE = "token_file"
+	// AUTH_APPROLE logs in with a RoleId & SecretId.
+	AUTH_APPROLE = "approle"
+	// AUTH_KUBERNETES logs in with the JWT of a Kubernetes service account.
+	AUTH_KUBERNETES = "kubernetes"
+	// AUTH_CERT logs in with the client certificate of the TlsClient.
+	AUTH_CERT = "cert"
+)
+
+// K8S_JWT_PATH is where Kubernetes mounts the token of a service account.
+const K8S_JWT_PATH = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// OpenbaoAuth declares an authentication method. The Method field decides which
+// other fields are read.
+//
+//   - token: no other fields.
+//   - token_file: TokenPath.
+//   - approle: RoleId & SecretId. Pair the SecretId with a file:// reference.
+//   - kubernetes: Role, and JwtPath.
+//   - cert: an optional Role naming the certificate role.
+type OpenbaoAuth struct {
+	// Method is one of token, token_file, approle, kubernetes, or cert.
+	// Defaults to token.
+	Method string `json:"method"`
+	// Mount is where the auth method is enabled. Defaults to the name of the
+	// method, e.g., approle.
+	Mount string `json:"mount"`
+	// Role is the role of the kubernetes or cert method.
+	Role string `json:"role"`
+	// RoleId identifies an AppRole.
+	RoleId string `json:"role_id"`
+	// SecretId is the credential of an AppRole.
+	SecretId string `json:"secret_id"`
+	// JwtPath is where to find the JWT of a service account. Defaults to
+	// K8S_JWT_PATH.
+	JwtPath string `json:"jwt_path"`
+	// TokenPath is where to find a token written by an Openbao agent.
+	TokenPath string `json:"token_path"`
 }
 
 // ReadConfig is the rare method on a struct in this configuration file. It
@@ -105,8 +282,46 @@ type Data struct {
 	Relational []Rdb `json:"relational"`
 }
 
+// Position finds a database in the Relational array by name.
+func (d *Data) Position(name string) (int, bool) {
+	for i, db := range d.Relational {
+		if db.Name == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Cluster lists the names of the primary & replicas of a cluster. The primary
+// is blank when the cluster lacks one.
+func (d *Data) Cluster(name string) (string, []string) {
+	primary, replicas := "", []string{}
+	for _, db := range d.Relational {
+		if db.Cluster != name {
+			continue
+		}
+		switch db.Role {
+		case ROLE_PRIMARY:
+			primary = db.Name
+		case ROLE_REPLICA:
+			replicas = append(replicas, db.Name)
+		}
+	}
+	return primary, replicas
+}
+
+const (
+	// ROLE_PRIMARY accepts writes, and serves reads when no replica can.
+	ROLE_PRIMARY = "primary"
+	// ROLE_REPLICA is a streaming replica serving read-only queries.
+	ROLE_REPLICA = "replica"
+)
+
 // Rdb represents a Postgres connection.
 type Rdb struct {
+	// Name identifies the database in the rdbms.Registry. Defaults to
+	// Database, and must be unique.
+	Name string `json:"name"`
 	Host string `json:"host"`
 	Port string `json:"port"`
 	User string `json:"user"`
@@ -119,17 +334,91 @@ type Rdb struct {
 	Secret string `json:"secret"`
 	// SecretKey is an Openbao JSON data field returned from the endpoint.
 	SecretKey string `json:"secret_key"`
+	// SecretMount is the KV mount holding the Secret. Defaults to kv_mount.
+	SecretMount string `json:"secret_mount"`
+	// CredsRole is a role of the Openbao database secrets engine. When set,
+	// the user & password are leased from the engine instead of reading User,
+	// Secret, & SecretKey.
+	CredsRole string `json:"creds_role"`
+	// CredsMount is where the database secrets engine is enabled. Defaults to
+	// database.
+	CredsMount string `json:"creds_mount"`
+	// Role is primary or replica, and makes the database part of an
+	// rdbms.Cluster. Blank for a standalone database.
+	Role string `json:"role"`
+	// Cluster names the cluster of a primary or replica. A primary defaults to
+	// its own Name.
+	Cluster string `json:"cluster"`
+	// MaxLag is the amount of seconds a replica may trail the primary before
+	// reads avoid it. Zero ignores lag.
+	MaxLag int `json:"max_lag"`
+
+	// The remaining fields tune the connection pool. Zero values keep the
+	// defaults of pgxpool & Postgres.
+
+	// PoolMaxConns is the maximum size of the pool.
+	PoolMaxConns int `json:"pool_max_conns"`
+	// PoolMinConns is the amount of connections kept open while idle.
+	PoolMinConns int `json:"pool_min_conns"`
+	// MaxConnLifetime is the amount of seconds a connection may live.
+	MaxConnLifetime int `json:"max_conn_lifetime"`
+	// MaxConnIdleTime is the amount of seconds an idle connection may live.
+	MaxConnIdleTime int `json:"max_conn_idle_time"`
+	// HealthCheckPeriod is the amount of seconds between checks of idle
+	// connections.
+	HealthCheckPeriod int `json:"health_check_period"`
+	// ApplicationName is reported to Postgres, e.g., in pg_stat_activity.
+	ApplicationName string `json:"application_name"`
+	// StatementTimeout is the amount of milliseconds a statement may run.
+	StatementTimeout int `json:"statement_timeout"`
+	// SearchPath is a comma separated list of schemas.
+	SearchPath string `json:"search_path"`
+	// QueryExecMode is the default query execution mode of pgx. It is one of
+	// cache_statement, cache_describe, describe_exec, exec, or simple_protocol.
+	// Poolers like PgBouncer may need exec or simple_protocol.
+	QueryExecMode string `json:"query_exec_mode"`
 }
 
+// QUERY_EXEC_MODES lists the accepted values of Rdb.QueryExecMode.
+var QUERY_EXEC_MODES = []string{"cache_statement", "cache_describe", "describe_exec", "exec", "simple_protocol"}
+
+// Modes of the HttpServer.
+const (
+	MODE_TLS       = "tls"
+	MODE_MTLS      = "mtls"
+	MODE_PLAINTEXT = "plaintext"
+	MODE_H2C       = "h2c"
+)
+
+// Client certificate policies of the HttpServer.
+const (
+	CLIENT_AUTH_REQUEST = "request"
+	CLIENT_AUTH_REQUIRE = "require"
+)
+
+// Kinds of TlsSecret sources.
+const (
+	// TLS_FILE reads PEM files from the local filesystem.
+	TLS_FILE = "file"
+	// TLS_OPENBAO_KV reads base64 encoded PEM values from an Openbao KV engine.
+	TLS_OPENBAO_KV = "openbao_kv"
+	// TLS_OPENBAO_PKI asks the Openbao PKI engine to issue a new certificate.
+	TLS_OPENBAO_PKI = "openbao_pki"
+	// TLS_INLINE reads PEM values, or base64 encoded PEM values, directly from
+	// the config. Pair it with env:// or file:// references.
+	TLS_INLINE = "inline"
+)
+
 // TlsSecret can be used by the application either as a server or a client for
-// mutual TLS inside the same network. The fields often represent HTTP endpoints
-// on an Openbao server, and the subsequent JSON key in the returned data. The
-// Openbao client relies on the paths in these fields to read CAs, certs, & keys
-// hidden in an Openbao server.
+// mutual TLS inside the same network. The Source field declares where the CA,
+// cert, & key are found, and decides which other fields are read.
 //
-// This struct is also used to represent local file paths when configuring an
-// Openbao client. I overloaded this struct. It can represent either an Openbao
-// HTTP endpoint or a local file path.
+//   - file: CaPath, CertPath, & KeyPath are local file paths.
+//   - openbao_kv: CaPath, CertPath, & KeyPath are paths in the Openbao KV
+//     engine, and CaField, CertField, & KeyField are JSON keys in the data.
+//   - openbao_pki: Role, CommonName, AltNames, & Ttl describe a certificate
+//     issued by the Openbao PKI engine at Mount, or signed when SignCsr.
+//   - inline: CaPem, CertPem, & KeyPem hold the PEM values.
 //
 // First, an Openbao client is configured with a local CA, cert, & key. Second,
 // the application uses the Openbao client to contact the Openbao server. The
@@ -138,8 +427,14 @@ type Rdb struct {
 // those CAs, certs, & keys hidden in Openbao. Then those clients open secure
 // connections to those databases.
 type TlsSecret struct {
+	// Source is one of file, openbao_kv, openbao_pki, or inline. When blank,
+	// the Openbao client defaults to file, and everything else defaults to
+	// openbao_kv.
+	Source string `json:"source"`
 	// CaPath is where to find an intermediate Certificate Authority.
 	CaPath string `json:"ca_path"`
+	// CaField is where to find the CA when reading from an Openbao server.
+	CaField string `json:"ca_field"`
 	// CertPath is where to find a x509 certificate.
 	CertPath string `json:"cert_path"`
 	// CertField is where to find a x509 certificate when reading from an
@@ -149,6 +444,34 @@ type TlsSecret struct {
 	KeyPath string `json:"key_path"`
 	// KeyField is where to find a x509 key when reading from an Openbao server.
 	KeyField string `json:"key_field"`
+	// CaPem is an inline CA.
+	CaPem string `json:"ca_pem"`
+	// CertPem is an inline x509 certificate.
+	CertPem string `json:"cert_pem"`
+	// KeyPem is an inline x509 key.
+	KeyPem string `json:"key_pem"`
+	// Mount is where the Openbao PKI engine is enabled, defaulting to pki, or
+	// where the KV engine is enabled, defaulting to kv_mount.
+	Mount string `json:"mount"`
+	// Role is the Openbao PKI role that issues a certificate.
+	Role string `json:"role"`
+	// CommonName is requested from the Openbao PKI engine.
+	CommonName string `json:"common_name"`
+	// AltNames are DNS or email subject alternative names requested from the
+	// Openbao PKI engine.
+	AltNames []string `json:"alt_names"`
+	// Ttl is the requested lifetime of an issued certificate, e.g., 72h.
+	Ttl string `json:"ttl"`
+	// SignCsr generates the private key locally, and only sends a CSR to the
+	// Openbao PKI engine, so the key never leaves the process.
+	SignCsr bool `json:"sign_csr"`
+}
+
+// defaultSource fills a blank Source, so older config files keep working.
+func (t *TlsSecret) defaultSource(kind string) {
+	if t != nil && t.Source == "" {
+		t.Source = kind
+	}
 }
 
 // RateLimiter configures a token bucket rate limiter for all routes. Each token
@@ -176,10 +499,87 @@ type PreventCORF struct {
 	Bypass []string `json:"bypass"`
 }
 
+// CipherSuiteIDs translates names into IDs. Only the secure suites offered by
+// crypto/tls are accepted.
+func CipherSuiteIDs(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, errors.New("Unknown or insecure cipher suite: " + name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// CURVES translates the names accepted in HttpServer.Curves.
+var CURVES = map[string]tls.CurveID{
+	"X25519MLKEM768": tls.X25519MLKEM768,
+	"X25519":         tls.X25519,
+	"P256":           tls.CurveP256,
+	"P384":           tls.CurveP384,
+	"P521":           tls.CurveP521,
+}
+
+// CurveIDs translates names into CurveIDs.
+func CurveIDs(names []string) ([]tls.CurveID, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]tls.CurveID, 0, len(names))
+	for _, name := range names {
+		id, ok := CURVES[name]
+		if !ok {
+			return nil, errors.New("Unknown curve: " + name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
 // HttpServer expects a CA, x509 cert, & key as a server. And a x509 cert & key
 // as a client for an internal network.
 type HttpServer struct {
+	// Host is the interface to bind, e.g., 127.0.0.1. Blank binds every
+	// interface.
+	Host string `json:"host"`
 	Port string `json:"port"`
+	// Socket is an optional Unix domain socket path. It replaces Host & Port.
+	Socket string `json:"socket"`
+	// Mode is one of tls, mtls, plaintext, or h2c. Defaults to tls. The mtls
+	// mode requires client certificates signed by the intermediate CA. The
+	// plaintext & h2c modes suit a server behind a mesh sidecar that
+	// terminates TLS.
+	Mode string `json:"mode"`
+	// ClientAuth is either request or require. The request value verifies a
+	// client certificate only when one is offered, and require rejects
+	// clients lacking one. Blank requests nothing, except in the mtls mode
+	// which always requires a client certificate.
+	ClientAuth string `json:"client_auth"`
+	// MinTlsVersion is either 1.2 or 1.3. Defaults to 1.3.
+	MinTlsVersion string `json:"min_tls_version"`
+	// CipherSuites are names from crypto/tls, e.g.,
+	// TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256. They only apply to TLS 1.2.
+	CipherSuites []string `json:"cipher_suites"`
+	// Curves are preferred key exchanges, e.g., X25519MLKEM768, X25519, P256.
+	Curves []string `json:"curves"`
+	// MaxHeaderBytes limits the size of request headers. Zero adopts the
+	// default of net/http.
+	MaxHeaderBytes int `json:"max_header_bytes"`
+	// TimeoutReadHeader is the amount of seconds allowed to read request
+	// headers. Zero adopts TimeoutRead.
+	TimeoutReadHeader int `json:"timeout_read_header"`
 	// TimeoutRead is the amount of seconds allowed to read an entire request,
 	// including the body.
 	TimeoutRead int `json:"timeout_read"`
@@ -197,6 +597,13 @@ type HttpServer struct {
 	SecretCAKey string `json:"secret_ca_key"`
 	// TlsServer is configuration for the application to become a secure server.
 	TlsServer *TlsSecret `json:"tls_server"`
+	// CertRenewBefore is the amount of seconds before the server certificate
+	// expires to fetch a new one. Zero renews after two thirds of its lifetime.
+	CertRenewBefore int `json:"cert_renew_before"`
+	// CertWarnBefore is the amount of seconds before the server certificate
+	// expires to fail the health check. Zero warns during the final tenth of
+	// its lifetime.
+	CertWarnBefore int `json:"cert_warn_before"`
 	// TlsClient is configuration for the application to become a secure client.
 	TlsClient *TlsSecret `json:"tls_client"`
 	// GlobalRateLimiter is an optional rate limiter.
@@ -227,8 +634,12 @@ type Health struct {
 type Test struct {
 	// DbPosition is an index into the Data.Relational array.
 	DbPosition int `json:"db_position"`
+	// Database names the database used by tests instead of DbPosition.
+	Database string `json:"database"`
 	// FakeData is a local file path to identify .sql scripts.
 	FakeData string `json:"fake_data"`
+	// Migrations is a directory of migrations applied before FakeData.
+	Migrations string `json:"migrations"`
 }
 
 // Metrics enables or disables various types of runtime metrics.
@@ -261,4 +672,6 @@ type Cache struct {
 	Secret string `json:"secret"`
 	// SecretKey is a Openbao JSON data field.
 	SecretKey string `json:"secret_key"`
+	// SecretMount is the KV mount holding the Secret. Defaults to kv_mount.
+	SecretMount string `json:"secret_mount"`
 }
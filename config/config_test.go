@@ -0,0 +1,400 @@
+package config_test
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/Shoowa/vamos/config"
+	. "github.com/Shoowa/vamos/testhelper"
+)
+
+func TestMain(m *testing.M) {
+	Change_to_project_root()
+	code := m.Run()
+	os.Exit(code)
+}
+
+// writeConfig places a JSON document in a temporary directory and returns the
+// path to it.
+func writeConfig(t *testing.T, name string, doc string) string {
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(doc), 0o600)
+	Ok(t, err)
+	return path
+}
+
+func Test_Load_DevFile(t *testing.T) {
+	cfg, err := Load("config/dev.json")
+	Ok(t, err)
+	Equals(t, "8443", cfg.HttpServer.Port)
+	Equals(t, 1, len(cfg.Data.Relational))
+}
+
+func Test_Load_MissingFile(t *testing.T) {
+	_, err := Load(filepath.Join(t.TempDir(), "absent.json"))
+	Assert(t, errors.Is(err, os.ErrNotExist), "Expected a missing file error, got %v", err)
+}
+
+func Test_Load_MalformedJSON(t *testing.T) {
+	path := writeConfig(t, "bad.json", `{"logger": `)
+	_, err := Load(path)
+	Assert(t, err != nil, "Expected a parsing error.")
+}
+
+func Test_Load_AggregatesProblems(t *testing.T) {
+	doc := `{
+		"logger": {"debug": true},
+		"test": {"db_position": 0},
+		"httpserver": {
+			"port": "https",
+			"timeout_read": 0,
+			"timeout_write": 10,
+			"timeout_idle": 5,
+			"global_rate_limiter": {"active": true, "average": 10, "burst": 0}
+		}
+	}`
+	path := writeConfig(t, "partial.json", doc)
+
+	_, err := Load(path)
+	var vErr *ValidationError
+	Assert(t, errors.As(err, &vErr), "Expected a ValidationError, got %v", err)
+
+	paths := map[string]bool{}
+	for _, p := range vErr.Problems {
+		paths[p.Path] = true
+	}
+
+	expected := []string{
+		"secrets",
+		"health",
+		"metrics",
+		"data.relational",
+		"httpserver.port",
+		"httpserver.tls_server",
+		"httpserver.timeout_read",
+		"httpserver.global_rate_limiter.burst",
+	}
+	for _, p := range expected {
+		Assert(t, paths[p], "Missing problem for %v in %v", p, err)
+	}
+	Equals(t, len(expected), len(vErr.Problems))
+}
+
+func Test_ApplyEnv_Overrides(t *testing.T) {
+	t.Setenv("VAMOS_HTTPSERVER_PORT", "9443")
+	t.Setenv("VAMOS_HTTPSERVER_TIMEOUT_IDLE", "90")
+	t.Setenv("VAMOS_HTTPSERVER_GLOBAL_RATE_LIMITER_AVERAGE", "12.5")
+	t.Setenv("VAMOS_HTTPSERVER_CHECK_CORF_DOMAINS", "https://a.example, https://b.example")
+	t.Setenv("VAMOS_DATA_RELATIONAL_0_HOST", "db.internal")
+	t.Setenv("VAMOS_DATA_RELATIONAL_1_HOST", "replica.internal")
+	t.Setenv("VAMOS_DATA_RELATIONAL_1_PORT", "5433")
+	t.Setenv("VAMOS_DATA_RELATIONAL_1_USER", "reader")
+	t.Setenv("VAMOS_DATA_RELATIONAL_1_DATABASE", "test_data")
+	t.Setenv("VAMOS_DATA_RELATIONAL_1_NAME", "replica")
+	t.Setenv("VAMOS_CACHE_SSLMODE", "false")
+	t.Setenv("VAMOS_HEALTH_HEAP_SIZE", "250")
+
+	cfg, err := Load("config/dev.json")
+	Ok(t, err)
+
+	Equals(t, "9443", cfg.HttpServer.Port)
+	Equals(t, 90, cfg.HttpServer.TimeoutIdle)
+	Equals(t, 12.5, cfg.HttpServer.GlobalRateLimiter.Average)
+	Equals(t, []string{"https://a.example", "https://b.example"}, cfg.HttpServer.CheckCORF.Domains)
+	Equals(t, "db.internal", cfg.Data.Relational[0].Host)
+	Equals(t, "tester", cfg.Data.Relational[0].User)
+	Equals(t, 2, len(cfg.Data.Relational))
+	Equals(t, "replica.internal", cfg.Data.Relational[1].Host)
+	Equals(t, "replica", cfg.Data.Relational[1].Name)
+	Equals(t, "test_data", cfg.Data.Relational[0].Name)
+	Equals(t, false, cfg.Cache.Sslmode)
+	Equals(t, uint64(250), cfg.Health.HeapSize)
+}
+
+func Test_ApplyEnv_UnparseableValues(t *testing.T) {
+	t.Setenv("VAMOS_HTTPSERVER_TIMEOUT_READ", "five")
+	t.Setenv("VAMOS_CACHE_SSLMODE", "maybe")
+
+	_, err := Load("config/dev.json")
+	Assert(t, err != nil, "Expected an error for unparseable values.")
+	for _, name := range []string{"VAMOS_HTTPSERVER_TIMEOUT_READ", "VAMOS_CACHE_SSLMODE"} {
+		Assert(t, strings.Contains(err.Error(), name), "Missing %v in %v", name, err)
+	}
+}
+
+func Test_Read_MergesLayers(t *testing.T) {
+	dev, err := os.ReadFile("config/dev.json")
+	Ok(t, err)
+
+	dir := t.TempDir()
+	Ok(t, os.WriteFile(filepath.Join(dir, "base.json"), dev, 0o600))
+	staging := `{"httpserver": {"port": "9443", "check_corf": {"domains": ["https://staging.example"]}}}`
+	Ok(t, os.WriteFile(filepath.Join(dir, "staging.json"), []byte(staging), 0o600))
+	local := `{"httpserver": {"timeout_idle": 120}}`
+	Ok(t, os.WriteFile(filepath.Join(dir, "local.json"), []byte(local), 0o600))
+
+	t.Setenv("CONFIG_DIR", dir)
+	t.Setenv("APP_ENV", "STAGING")
+
+	paths, pathsErr := Files()
+	Ok(t, pathsErr)
+	Equals(t, 3, len(paths))
+
+	cfg, cfgErr := Read()
+	Ok(t, cfgErr)
+	Equals(t, "9443", cfg.HttpServer.Port)
+	Equals(t, 120, cfg.HttpServer.TimeoutIdle)
+	Equals(t, 10, cfg.HttpServer.TimeoutWrite)
+	Equals(t, []string{"https://staging.example"}, cfg.HttpServer.CheckCORF.Domains)
+	Equals(t, false, cfg.HttpServer.CheckCORF.Active)
+}
+
+func Test_Read_ConfigFile(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "config/dev.json")
+	t.Setenv("APP_ENV", "nowhere")
+
+	cfg, err := Read()
+	Ok(t, err)
+	Equals(t, "8443", cfg.HttpServer.Port)
+}
+
+func Test_Read_MissingEnvironment(t *testing.T) {
+	t.Setenv("CONFIG_DIR", t.TempDir())
+	t.Setenv("APP_ENV", "nowhere")
+
+	_, err := Read()
+	Assert(t, err != nil, "Expected an error when no file exists.")
+}
+
+func Test_Watcher_PublishesValidReloads(t *testing.T) {
+	dev, err := os.ReadFile("config/dev.json")
+	Ok(t, err)
+
+	dir := t.TempDir()
+	Ok(t, os.WriteFile(filepath.Join(dir, "base.json"), dev, 0o600))
+	t.Setenv("CONFIG_DIR", dir)
+	t.Setenv("APP_ENV", "staging")
+
+	cfg, cfgErr := Read()
+	Ok(t, cfgErr)
+
+	w, wErr := NewWatcher(cfg, slog.New(slog.DiscardHandler))
+	Ok(t, wErr)
+
+	published := []*Config{}
+	w.Subscribe(func(c *Config) { published = append(published, c) })
+
+	// An invalid overlay is rejected, and nothing is published.
+	staging := filepath.Join(dir, "staging.json")
+	Ok(t, os.WriteFile(staging, []byte(`{"httpserver": {"port": "0"}}`), 0o600))
+	Assert(t, w.Reload() != nil, "Expected an invalid reload to be rejected.")
+	Equals(t, 0, len(published))
+	Equals(t, cfg, w.Current())
+
+	Ok(t, os.WriteFile(staging, []byte(`{"logger": {"debug": false}}`), 0o600))
+	Ok(t, w.Reload())
+	Equals(t, 1, len(published))
+	Equals(t, false, w.Current().Logger.Debug)
+}
+
+func Test_ResolveRefs(t *testing.T) {
+	hostFile := writeConfig(t, "redis_host", "cache.internal\n")
+	jsonFile := writeConfig(t, "creds.json", `{"user": "reader"}`)
+	t.Setenv("PGHOST", "db.internal")
+	t.Setenv("VAMOS_DATA_RELATIONAL_0_HOST", "env://PGHOST")
+	t.Setenv("VAMOS_DATA_RELATIONAL_0_USER", "file://"+jsonFile+"#user")
+	t.Setenv("VAMOS_CACHE_HOST", "file://"+hostFile)
+	t.Setenv("VAMOS_CACHE_USER", "bao://secret/dev-redis-test#user")
+	t.Setenv("VAMOS_HTTPSERVER_CHECK_CORF_DOMAINS", "https://a.example")
+
+	cfg, err := Load("config/dev.json")
+	Ok(t, err)
+	Equals(t, "db.internal", cfg.Data.Relational[0].Host)
+	Equals(t, "reader", cfg.Data.Relational[0].User)
+	Equals(t, "cache.internal", cfg.Cache.Host)
+	Equals(t, []string{"https://a.example"}, cfg.HttpServer.CheckCORF.Domains)
+
+	// Unknown schemes are left for the application to resolve later.
+	Equals(t, "bao://secret/dev-redis-test#user", cfg.Cache.User)
+
+	bao := ResolverFunc(func(ref Reference) (string, error) {
+		Equals(t, "secret/dev-redis-test", ref.Path)
+		Equals(t, "user", ref.Key)
+		return "cache-reader", nil
+	})
+	Ok(t, cfg.ResolveRefs(DefaultResolvers().With("bao", bao)))
+	Equals(t, "cache-reader", cfg.Cache.User)
+}
+
+func Test_ResolveRefs_ReportsPath(t *testing.T) {
+	t.Setenv("VAMOS_CACHE_HOST", "env://VAMOS_UNDEFINED_VARIABLE")
+
+	_, err := Load("config/dev.json")
+	Assert(t, err != nil, "Expected an error for an undefined variable.")
+	Assert(t, strings.Contains(err.Error(), "cache.host"), "Missing JSON path in %v", err)
+}
+
+func Test_Validate_TlsSources(t *testing.T) {
+	t.Setenv("VAMOS_SECRETS_OPENBAO_TLS_CLIENT_SOURCE", TLS_OPENBAO_KV)
+	t.Setenv("VAMOS_HTTPSERVER_TLS_SERVER_SOURCE", TLS_OPENBAO_PKI)
+
+	_, err := Load("config/dev.json")
+	var vErr *ValidationError
+	Assert(t, errors.As(err, &vErr), "Expected a ValidationError, got %v", err)
+
+	expected := []Problem{
+		{"secrets.openbao.tls_client.source", "must be one of file, inline, got \"openbao_kv\""},
+		{"httpserver.tls_server.role", "must not be empty"},
+		{"httpserver.tls_server.common_name", "must not be empty"},
+	}
+	Equals(t, expected, vErr.Problems)
+}
+
+func Test_Validate_OpenbaoAuth(t *testing.T) {
+	cfg, cfgErr := Load("config/dev.json")
+	Ok(t, cfgErr)
+	Equals(t, AUTH_TOKEN, cfg.Secrets.Openbao.Auth.Method)
+
+	t.Setenv("VAMOS_SECRETS_OPENBAO_AUTH_METHOD", AUTH_APPROLE)
+
+	_, err := Load("config/dev.json")
+	var vErr *ValidationError
+	Assert(t, errors.As(err, &vErr), "Expected a ValidationError, got %v", err)
+
+	expected := []Problem{
+		{"secrets.openbao.auth.role_id", "must not be empty"},
+		{"secrets.openbao.auth.secret_id", "must not be empty"},
+	}
+	Equals(t, expected, vErr.Problems)
+}
+
+func Test_Validate_SecretsProvider(t *testing.T) {
+	cfg, cfgErr := Load("config/dev.json")
+	Ok(t, cfgErr)
+	Equals(t, PROVIDER_OPENBAO, cfg.Secrets.Provider)
+
+	// The Openbao section is ignored by other providers.
+	t.Setenv("VAMOS_SECRETS_PROVIDER", PROVIDER_ENV)
+	t.Setenv("VAMOS_SECRETS_OPENBAO_AUTH_METHOD", AUTH_APPROLE)
+	_, envErr := Load("config/dev.json")
+	Ok(t, envErr)
+
+	t.Setenv("VAMOS_SECRETS_PROVIDER", PROVIDER_DIR)
+	_, err := Load("config/dev.json")
+	var vErr *ValidationError
+	Assert(t, errors.As(err, &vErr), "Expected a ValidationError, got %v", err)
+	Equals(t, []Problem{{"secrets.dir", "must not be empty"}}, vErr.Problems)
+}
+
+func Test_Validate_RdbTuning(t *testing.T) {
+	t.Setenv("VAMOS_DATA_RELATIONAL_0_POOL_MAX_CONNS", "4")
+	t.Setenv("VAMOS_DATA_RELATIONAL_0_POOL_MIN_CONNS", "8")
+	t.Setenv("VAMOS_DATA_RELATIONAL_0_STATEMENT_TIMEOUT", "-1")
+	t.Setenv("VAMOS_DATA_RELATIONAL_0_QUERY_EXEC_MODE", "pipeline")
+
+	_, err := Load("config/dev.json")
+	var vErr *ValidationError
+	Assert(t, errors.As(err, &vErr), "Expected a ValidationError, got %v", err)
+
+	expected := []Problem{
+		{"data.relational.0.statement_timeout", "must not be negative, got -1"},
+		{"data.relational.0.pool_min_conns", "must not exceed pool_max_conns 4, got 8"},
+		{"data.relational.0.query_exec_mode", "must be one of cache_statement, cache_describe, describe_exec, exec, simple_protocol, got \"pipeline\""},
+	}
+	Equals(t, expected, vErr.Problems)
+}
+
+func Test_Validate_DatabaseNames(t *testing.T) {
+	dir := t.TempDir()
+	layer := `{
+		"test": {"database": "missing"},
+		"data": {"relational": [
+			{"host": "localhost", "port": "5432", "user": "tester", "database": "test_data", "secret": "dev-postgres-test", "secret_key": "password"},
+			{"name": "test_data", "host": "replica", "port": "5432", "user": "tester", "database": "other", "secret": "dev-postgres-test", "secret_key": "password"}
+		]}
+	}`
+	Ok(t, os.WriteFile(filepath.Join(dir, "names.json"), []byte(layer), 0o600))
+
+	_, err := LoadFiles("config/dev.json", filepath.Join(dir, "names.json"))
+	var vErr *ValidationError
+	Assert(t, errors.As(err, &vErr), "Expected a ValidationError, got %v", err)
+
+	expected := []Problem{
+		{"data.relational.1.name", "must be unique, got \"test_data\" twice"},
+		{"test.database", "no database named \"missing\""},
+	}
+	Equals(t, expected, vErr.Problems)
+}
+
+func Test_Validate_ClusterRoles(t *testing.T) {
+	dir := t.TempDir()
+	layer := `{
+		"data": {"relational": [
+			{"name": "main", "role": "primary", "host": "primary", "port": "5432", "user": "tester", "database": "test_data"},
+			{"name": "replica-a", "role": "replica", "cluster": "main", "max_lag": 5, "host": "replica-a", "port": "5432", "user": "tester", "database": "test_data"},
+			{"name": "replica-b", "role": "replica", "cluster": "other", "host": "replica-b", "port": "5432", "user": "tester", "database": "test_data"},
+			{"name": "replica-c", "role": "standby", "max_lag": -1, "host": "replica-c", "port": "5432", "user": "tester", "database": "test_data"}
+		]}
+	}`
+	Ok(t, os.WriteFile(filepath.Join(dir, "cluster.json"), []byte(layer), 0o600))
+
+	_, err := LoadFiles("config/dev.json", filepath.Join(dir, "cluster.json"))
+	var vErr *ValidationError
+	Assert(t, errors.As(err, &vErr), "Expected a ValidationError, got %v", err)
+
+	expected := []Problem{
+		{"data.relational.3.role", "must be one of primary, replica, got \"standby\""},
+		{"data.relational.3.max_lag", "must not be negative, got -1"},
+		{"data.relational.2.cluster", "no primary in cluster \"other\""},
+	}
+	Equals(t, expected, vErr.Problems)
+
+	data := &Data{Relational: []Rdb{
+		{Name: "main", Role: ROLE_PRIMARY, Cluster: "main"},
+		{Name: "replica-a", Role: ROLE_REPLICA, Cluster: "main"},
+		{Name: "standalone"},
+	}}
+	primary, replicas := data.Cluster("main")
+	Equals(t, "main", primary)
+	Equals(t, []string{"replica-a"}, replicas)
+}
+
+func Test_TlsNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		ciphers []string
+		curves  []string
+		fails   bool
+	}{
+		{"blank keeps the defaults", nil, nil, false},
+		{"known names", []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}, []string{"X25519MLKEM768", "P256"}, false},
+		{"insecure cipher suite", []string{"TLS_RSA_WITH_RC4_128_SHA"}, nil, true},
+		{"unknown curve", nil, []string{"P224"}, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ciphers, cipherErr := CipherSuiteIDs(tc.ciphers)
+			curves, curveErr := CurveIDs(tc.curves)
+			Equals(t, tc.fails, cipherErr != nil || curveErr != nil)
+			if !tc.fails {
+				Equals(t, len(tc.ciphers), len(ciphers))
+				Equals(t, len(tc.curves), len(curves))
+			}
+		})
+	}
+
+	t.Setenv("VAMOS_HTTPSERVER_CIPHER_SUITES", "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,TLS_RSA_WITH_RC4_128_SHA")
+	t.Setenv("VAMOS_HTTPSERVER_CURVES", "X25519,P224")
+	_, err := Load("config/dev.json")
+	var vErr *ValidationError
+	Assert(t, errors.As(err, &vErr), "Expected a ValidationError, got %v", err)
+	expected := []Problem{
+		{"httpserver.cipher_suites.1", "unknown or insecure cipher suite \"TLS_RSA_WITH_RC4_128_SHA\""},
+		{"httpserver.curves.1", "unknown curve \"P224\""},
+	}
+	Equals(t, expected, vErr.Problems)
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ENV_PREFIX begins the name of every environ variable that can override a
+// value read from a config file.
+const ENV_PREFIX = "VAMOS"
+
+// ApplyEnv overlays environ variables onto the Config. The name of each
+// variable is derived from the JSON tags leading to a field, joined by
+// underscores and capitalized. An index selects an entry in a list.
+//
+//	VAMOS_HTTPSERVER_PORT=9443
+//	VAMOS_DATA_RELATIONAL_0_HOST=db.internal
+//	VAMOS_HTTPSERVER_CHECK_CORF_DOMAINS=https://a.example,https://b.example
+//
+// A list of strings is read as comma separated values. Every value that can't
+// be parsed into the type of its field is reported.
+func (c *Config) ApplyEnv() error {
+	o := &overlay{lookup: os.LookupEnv}
+	o.walk(reflect.ValueOf(c).Elem(), ENV_PREFIX)
+	return errors.Join(o.errs...)
+}
+
+// overlay walks a struct and reads a matching environ variable for each field.
+type overlay struct {
+	lookup func(string) (string, bool)
+	errs   []error
+}
+
+// jsonName returns the name in a JSON tag, or an empty string when a field
+// lacks a tag or is skipped.
+func jsonName(field reflect.StructField) string {
+	tag := field.Tag.Get("json")
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// walk reports whether any environ variable was applied beneath a value. That
+// report decides whether a missing section or list entry should be created.
+func (o *overlay) walk(v reflect.Value, name string) bool {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.Type().Elem().Kind() != reflect.Struct {
+			return false
+		}
+		if v.IsNil() {
+			fresh := reflect.New(v.Type().Elem())
+			if o.walk(fresh.Elem(), name) {
+				v.Set(fresh)
+				return true
+			}
+			return false
+		}
+		return o.walk(v.Elem(), name)
+
+	case reflect.Struct:
+		applied := false
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			tag := jsonName(field)
+			if !field.IsExported() || tag == "" {
+				continue
+			}
+			if o.walk(v.Field(i), name+"_"+strings.ToUpper(tag)) {
+				applied = true
+			}
+		}
+		return applied
+
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.String {
+			return o.scalar(v, name)
+		}
+		applied := false
+		for i := 0; ; i++ {
+			entry := fmt.Sprintf("%v_%v", name, i)
+			if i < v.Len() {
+				if o.walk(v.Index(i), entry) {
+					applied = true
+				}
+				continue
+			}
+			fresh := reflect.New(v.Type().Elem()).Elem()
+			if !o.walk(fresh, entry) {
+				return applied
+			}
+			v.Set(reflect.Append(v, fresh))
+			applied = true
+		}
+
+	default:
+		return o.scalar(v, name)
+	}
+}
+
+// scalar parses a single environ variable into a field.
+func (o *overlay) scalar(v reflect.Value, name string) bool {
+	raw, found := o.lookup(name)
+	if !found {
+		return false
+	}
+
+	var err error
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		var b bool
+		if b, err = strconv.ParseBool(raw); err == nil {
+			v.SetBool(b)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		if n, err = strconv.ParseInt(raw, 10, v.Type().Bits()); err == nil {
+			v.SetInt(n)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		if n, err = strconv.ParseUint(raw, 10, v.Type().Bits()); err == nil {
+			v.SetUint(n)
+		}
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		if f, err = strconv.ParseFloat(raw, v.Type().Bits()); err == nil {
+			v.SetFloat(f)
+		}
+	case reflect.Slice:
+		list := []string{}
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	default:
+		err = fmt.Errorf("unsupported type %v", v.Type())
+	}
+
+	if err != nil {
+		o.errs = append(o.errs, fmt.Errorf("config: environ %v=%q: cannot use as %v: %w", name, raw, v.Type(), err))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// DEFAULT_DIR is searched for config files when CONFIG_DIR is absent.
+	DEFAULT_DIR = "config"
+	// DEFAULT_ENV names the environment when APP_ENV is absent.
+	DEFAULT_ENV = "prod"
+	// BASE_FILE holds values shared by every environment.
+	BASE_FILE = "base.json"
+	// LOCAL_FILE holds overrides for a single machine, and shouldn't be
+	// committed.
+	LOCAL_FILE = "local.json"
+)
+
+// Environment reads the name of the deployment from APP_ENV, e.g., DEV or
+// staging. The name is lowercased to find a file, so DEV selects dev.json.
+func Environment() string {
+	env := strings.ToLower(os.Getenv("APP_ENV"))
+	if env == "" {
+		return DEFAULT_ENV
+	}
+	return env
+}
+
+// Files lists the config files that exist, in the order they are merged.
+//
+//  1. CONFIG_DIR/base.json
+//  2. CONFIG_DIR/<APP_ENV>.json
+//  3. CONFIG_DIR/local.json
+//
+// CONFIG_DIR defaults to the relative directory named config. When
+// CONFIG_FILE is defined, then that single file is used instead of any layers.
+func Files() ([]string, error) {
+	if file := os.Getenv("CONFIG_FILE"); file != "" {
+		return []string{file}, nil
+	}
+
+	dir := os.Getenv("CONFIG_DIR")
+	if dir == "" {
+		dir = DEFAULT_DIR
+	}
+
+	env := Environment()
+	if strings.ContainsAny(env, `/\`) || env == "." || env == ".." {
+		return nil, fmt.Errorf("config: invalid environment name %q", env)
+	}
+
+	candidates := []string{BASE_FILE, env + ".json", LOCAL_FILE}
+	paths := []string{}
+	for _, name := range candidates {
+		path := filepath.Join(dir, name)
+		_, statErr := os.Stat(path)
+		if errors.Is(statErr, os.ErrNotExist) {
+			continue
+		}
+		if statErr != nil {
+			return nil, fmt.Errorf("config: %w", statErr)
+		}
+		paths = append(paths, path)
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("config: no config file for environment %q in %v", env, dir)
+	}
+	return paths, nil
+}
+
+// merge deep-merges the src JSON object into dst. Nested objects are merged
+// key by key. Lists and single values in src replace those in dst.
+func merge(dst, src map[string]any) {
+	for key, value := range src {
+		srcMap, srcIsMap := value.(map[string]any)
+		dstMap, dstIsMap := dst[key].(map[string]any)
+		if srcIsMap && dstIsMap {
+			merge(dstMap, srcMap)
+			continue
+		}
+		dst[key] = value
+	}
+}
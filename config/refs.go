@@ -0,0 +1,184 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// Reference points to a value kept outside of the config file. Any string field
+// in the Config can hold a reference instead of a literal value.
+//
+//	bao://secret/dev-postgres-test#password
+//	env://PGHOST
+//	file:///run/secrets/redis_password
+//
+// The fragment selects a JSON key inside the referenced document.
+type Reference struct {
+	// Scheme selects a Resolver, e.g., bao, env, or file.
+	Scheme string
+	// Path joins the host and path of the reference, e.g.,
+	// secret/dev-postgres-test or /run/secrets/redis_password.
+	Path string
+	// Key is an optional JSON key inside the referenced document.
+	Key string
+	// Query holds optional parameters for a Resolver.
+	Query url.Values
+}
+
+// ParseReference reports whether a value is shaped like a reference, i.e.,
+// scheme://path#key, and parses it.
+func ParseReference(value string) (Reference, bool) {
+	if !strings.Contains(value, "://") {
+		return Reference{}, false
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" {
+		return Reference{}, false
+	}
+	return Reference{u.Scheme, u.Host + u.Path, u.Fragment, u.Query()}, true
+}
+
+func (r Reference) String() string {
+	s := r.Scheme + "://" + r.Path
+	if len(r.Query) > 0 {
+		s += "?" + r.Query.Encode()
+	}
+	if r.Key != "" {
+		s += "#" + r.Key
+	}
+	return s
+}
+
+// Resolver reads the value behind a Reference. The secrets.SkeletonKey is a
+// Resolver for the bao scheme.
+type Resolver interface {
+	Resolve(ref Reference) (string, error)
+}
+
+// ResolverFunc adapts a plain func into a Resolver.
+type ResolverFunc func(ref Reference) (string, error)
+
+func (f ResolverFunc) Resolve(ref Reference) (string, error) {
+	return f(ref)
+}
+
+// Resolvers maps a scheme to a Resolver. Values with a scheme that is absent
+// from the map are left untouched, so a URL like https://example.com is never
+// mistaken for a reference.
+type Resolvers map[string]Resolver
+
+// DefaultResolvers read environ variables and local files. They are applied
+// by Load. Other schemes, like bao, are resolved later by the application.
+func DefaultResolvers() Resolvers {
+	return Resolvers{
+		"env":  ResolverFunc(resolveEnv),
+		"file": ResolverFunc(resolveFile),
+	}
+}
+
+// With returns a copy of the Resolvers that includes another scheme.
+func (rs Resolvers) With(scheme string, r Resolver) Resolvers {
+	merged := make(Resolvers, len(rs)+1)
+	for k, v := range rs {
+		merged[k] = v
+	}
+	merged[scheme] = r
+	return merged
+}
+
+// Resolve returns the value behind a reference, or the original value when it
+// isn't a reference to a known scheme.
+func (rs Resolvers) Resolve(value string) (string, error) {
+	ref, ok := ParseReference(value)
+	if !ok {
+		return value, nil
+	}
+	r, known := rs[ref.Scheme]
+	if !known {
+		return value, nil
+	}
+	return r.Resolve(ref)
+}
+
+func resolveEnv(ref Reference) (string, error) {
+	v, found := os.LookupEnv(ref.Path)
+	if !found {
+		return "", fmt.Errorf("environ variable %v is undefined", ref.Path)
+	}
+	return v, nil
+}
+
+func resolveFile(ref Reference) (string, error) {
+	contents, err := os.ReadFile(ref.Path)
+	if err != nil {
+		return "", err
+	}
+	if ref.Key == "" {
+		return strings.TrimRight(string(contents), "\r\n"), nil
+	}
+
+	doc := map[string]any{}
+	jsonErr := json.Unmarshal(contents, &doc)
+	if jsonErr != nil {
+		return "", jsonErr
+	}
+	v, ok := doc[ref.Key].(string)
+	if !ok {
+		return "", fmt.Errorf("key %v is absent or not a string", ref.Key)
+	}
+	return v, nil
+}
+
+// ResolveRefs replaces every reference in every string field of the Config
+// with the value it points to. Each failure is reported with its JSON path.
+func (c *Config) ResolveRefs(rs Resolvers) error {
+	w := &refWalker{resolvers: rs}
+	w.walk(reflect.ValueOf(c).Elem(), "")
+	return errors.Join(w.errs...)
+}
+
+type refWalker struct {
+	resolvers Resolvers
+	errs      []error
+}
+
+func (w *refWalker) walk(v reflect.Value, path string) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			w.walk(v.Elem(), path)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			tag := jsonName(field)
+			if !field.IsExported() || tag == "" {
+				continue
+			}
+			w.walk(v.Field(i), join(path, tag))
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			w.walk(v.Index(i), join(path, fmt.Sprint(i)))
+		}
+	case reflect.String:
+		resolved, err := w.resolvers.Resolve(v.String())
+		if err != nil {
+			w.errs = append(w.errs, fmt.Errorf("config: %v: resolving reference: %w", path, err))
+			return
+		}
+		v.SetString(resolved)
+	}
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
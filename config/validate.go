@@ -0,0 +1,364 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Problem describes a single invalid value, and where it lives in the JSON
+// document.
+type Problem struct {
+	// Path is a dotted JSON path, e.g., httpserver.tls_server.cert_path
+	Path string
+	// Msg explains what is wrong with the value.
+	Msg string
+}
+
+// ValidationError aggregates every Problem found in a Config, so that a
+// developer can fix a config file in one pass instead of one panic at a time.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (v *ValidationError) Error() string {
+	lines := make([]string, 0, len(v.Problems))
+	for _, p := range v.Problems {
+		lines = append(lines, p.Path+": "+p.Msg)
+	}
+	return "config: invalid configuration:\n\t" + strings.Join(lines, "\n\t")
+}
+
+// validator collects problems while walking the Config.
+type validator struct {
+	problems []Problem
+}
+
+func (v *validator) add(path string, format string, args ...any) {
+	v.problems = append(v.problems, Problem{path, fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) required(path string, missing bool) bool {
+	if missing {
+		v.add(path, "section is required")
+	}
+	return !missing
+}
+
+func (v *validator) port(path string, value string) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > 65535 {
+		v.add(path, "port must be a number between 1 and 65535, got %q", value)
+	}
+}
+
+func (v *validator) positive(path string, value int) {
+	if value <= 0 {
+		v.add(path, "must be greater than zero, got %v", value)
+	}
+}
+
+func (v *validator) notEmpty(path string, value string) {
+	if value == "" {
+		v.add(path, "must not be empty")
+	}
+}
+
+// Validate inspects every section of the Config. It returns a
+// *ValidationError listing each problem with its JSON path, or nil.
+func (c *Config) Validate() error {
+	v := new(validator)
+
+	v.required("logger", c.Logger == nil)
+	if v.required("secrets", c.Secrets == nil) {
+		c.Secrets.validate(v, "secrets")
+	}
+	if c.Data != nil {
+		c.Data.validate(v, "data")
+	}
+	if v.required("httpserver", c.HttpServer == nil) {
+		c.HttpServer.validate(v, "httpserver")
+	}
+	if v.required("health", c.Health == nil) {
+		c.Health.validate(v, "health")
+	}
+	if c.Test != nil {
+		c.Test.validate(v, "test", c.Data)
+	}
+	v.required("metrics", c.Metrics == nil)
+	if c.Cache != nil {
+		c.Cache.validate(v, "cache")
+	}
+
+	if len(v.problems) > 0 {
+		return &ValidationError{v.problems}
+	}
+	return nil
+}
+
+func (s *Secrets) validate(v *validator, path string) {
+	switch s.Provider {
+	case PROVIDER_OPENBAO:
+		s.Openbao.validate(v, path+".openbao")
+	case PROVIDER_DIR:
+		v.notEmpty(path+".dir", s.Dir)
+	case PROVIDER_ENV:
+	default:
+		v.add(path+".provider", "must be one of %v, %v, %v, got %q", PROVIDER_OPENBAO, PROVIDER_DIR, PROVIDER_ENV, s.Provider)
+	}
+}
+
+func (o *Openbao) validate(v *validator, path string) {
+	v.notEmpty(path+".scheme", o.Scheme)
+	v.notEmpty(path+".host", o.Host)
+	v.port(path+".port", o.Port)
+	if v.required(path+".tls_client", o.TlsClient == nil) {
+		o.TlsClient.validate(v, path+".tls_client", TLS_FILE, TLS_INLINE)
+	}
+	if o.Timeout < 0 {
+		v.add(path+".timeout", "must not be negative, got %v", o.Timeout)
+	}
+	if o.Auth != nil {
+		o.Auth.validate(v, path+".auth", o.TlsClient)
+	}
+}
+
+func (a *OpenbaoAuth) validate(v *validator, path string, tlsClient *TlsSecret) {
+	switch a.Method {
+	case AUTH_TOKEN:
+	case AUTH_TOKEN_FILE:
+		v.notEmpty(path+".token_path", a.TokenPath)
+	case AUTH_APPROLE:
+		v.notEmpty(path+".role_id", a.RoleId)
+		v.notEmpty(path+".secret_id", a.SecretId)
+	case AUTH_KUBERNETES:
+		v.notEmpty(path+".role", a.Role)
+	case AUTH_CERT:
+		if tlsClient != nil && tlsClient.CertPath == "" && tlsClient.CertPem == "" {
+			v.add(path+".method", "needs a client certificate in tls_client")
+		}
+	default:
+		methods := []string{AUTH_TOKEN, AUTH_TOKEN_FILE, AUTH_APPROLE, AUTH_KUBERNETES, AUTH_CERT}
+		v.add(path+".method", "must be one of %v, got %q", strings.Join(methods, ", "), a.Method)
+	}
+}
+
+func (d *Data) validate(v *validator, path string) {
+	names := map[string]bool{}
+	for i := range d.Relational {
+		dbPath := fmt.Sprintf("%v.relational.%v", path, i)
+		d.Relational[i].validate(v, dbPath)
+
+		name := d.Relational[i].Name
+		if names[name] {
+			v.add(dbPath+".name", "must be unique, got %q twice", name)
+		}
+		names[name] = true
+	}
+
+	for i, db := range d.Relational {
+		if db.Role != ROLE_REPLICA || db.Cluster == "" {
+			continue
+		}
+		primary, _ := d.Cluster(db.Cluster)
+		if primary == "" {
+			v.add(fmt.Sprintf("%v.relational.%v.cluster", path, i), "no primary in cluster %q", db.Cluster)
+		}
+	}
+	primaries := map[string]bool{}
+	for i, db := range d.Relational {
+		if db.Role != ROLE_PRIMARY {
+			continue
+		}
+		if primaries[db.Cluster] {
+			v.add(fmt.Sprintf("%v.relational.%v.role", path, i), "must be the only primary of cluster %q", db.Cluster)
+		}
+		primaries[db.Cluster] = true
+	}
+}
+
+func (r *Rdb) validate(v *validator, path string) {
+	v.notEmpty(path+".host", r.Host)
+	v.port(path+".port", r.Port)
+	if r.CredsRole == "" {
+		v.notEmpty(path+".user", r.User)
+	}
+	v.notEmpty(path+".database", r.Database)
+
+	tuning := []struct {
+		field string
+		value int
+	}{
+		{".pool_max_conns", r.PoolMaxConns},
+		{".pool_min_conns", r.PoolMinConns},
+		{".max_conn_lifetime", r.MaxConnLifetime},
+		{".max_conn_idle_time", r.MaxConnIdleTime},
+		{".health_check_period", r.HealthCheckPeriod},
+		{".statement_timeout", r.StatementTimeout},
+	}
+	for _, t := range tuning {
+		if t.value < 0 {
+			v.add(path+t.field, "must not be negative, got %v", t.value)
+		}
+	}
+	if r.PoolMaxConns > 0 && r.PoolMinConns > r.PoolMaxConns {
+		v.add(path+".pool_min_conns", "must not exceed pool_max_conns %v, got %v", r.PoolMaxConns, r.PoolMinConns)
+	}
+	if r.QueryExecMode != "" && !slices.Contains(QUERY_EXEC_MODES, r.QueryExecMode) {
+		v.add(path+".query_exec_mode", "must be one of %v, got %q", strings.Join(QUERY_EXEC_MODES, ", "), r.QueryExecMode)
+	}
+
+	switch r.Role {
+	case "", ROLE_PRIMARY:
+	case ROLE_REPLICA:
+		v.notEmpty(path+".cluster", r.Cluster)
+	default:
+		v.add(path+".role", "must be one of %v, %v, got %q", ROLE_PRIMARY, ROLE_REPLICA, r.Role)
+	}
+	if r.MaxLag < 0 {
+		v.add(path+".max_lag", "must not be negative, got %v", r.MaxLag)
+	}
+}
+
+// validate ensures each source offers the fields it needs, and that a cert is
+// paired with a key.
+func (t *TlsSecret) validate(v *validator, path string, kinds ...string) {
+	if !slices.Contains(kinds, t.Source) {
+		v.add(path+".source", "must be one of %v, got %q", strings.Join(kinds, ", "), t.Source)
+		return
+	}
+
+	switch t.Source {
+	case TLS_FILE:
+		if t.CertPath != "" || t.KeyPath != "" {
+			v.notEmpty(path+".cert_path", t.CertPath)
+			v.notEmpty(path+".key_path", t.KeyPath)
+		}
+	case TLS_OPENBAO_KV:
+		if t.CertPath == "" && t.KeyPath == "" {
+			return
+		}
+		v.notEmpty(path+".cert_path", t.CertPath)
+		v.notEmpty(path+".cert_field", t.CertField)
+		v.notEmpty(path+".key_path", t.KeyPath)
+		v.notEmpty(path+".key_field", t.KeyField)
+		if t.CaPath != "" {
+			v.notEmpty(path+".ca_field", t.CaField)
+		}
+	case TLS_OPENBAO_PKI:
+		v.notEmpty(path+".role", t.Role)
+		v.notEmpty(path+".common_name", t.CommonName)
+	case TLS_INLINE:
+		if t.CertPem != "" || t.KeyPem != "" {
+			v.notEmpty(path+".cert_pem", t.CertPem)
+			v.notEmpty(path+".key_pem", t.KeyPem)
+		}
+	}
+}
+
+// allSources are accepted by any TLS consumer other than the Openbao client.
+var allSources = []string{TLS_FILE, TLS_OPENBAO_KV, TLS_OPENBAO_PKI, TLS_INLINE}
+
+func (r *RateLimiter) validate(v *validator, path string) {
+	if r.Active == false {
+		return
+	}
+	if r.Average <= 0 {
+		v.add(path+".average", "must be greater than zero, got %v", r.Average)
+	}
+	v.positive(path+".burst", r.Burst)
+}
+
+func (h *HttpServer) validate(v *validator, path string) {
+	if h.Socket == "" {
+		v.port(path+".port", h.Port)
+	}
+	modes := []string{MODE_TLS, MODE_MTLS, MODE_PLAINTEXT, MODE_H2C}
+	if !slices.Contains(modes, h.Mode) {
+		v.add(path+".mode", "must be one of %v, got %q", strings.Join(modes, ", "), h.Mode)
+	}
+	if (h.Mode == MODE_TLS || h.Mode == MODE_MTLS) && h.TlsServer == nil {
+		v.add(path+".tls_server", "section is required in mode %v", h.Mode)
+	}
+	switch h.ClientAuth {
+	case "", CLIENT_AUTH_REQUEST, CLIENT_AUTH_REQUIRE:
+		if h.ClientAuth != "" && h.Mode != MODE_TLS && h.Mode != MODE_MTLS {
+			v.add(path+".client_auth", "needs mode tls or mtls, got %q", h.Mode)
+		}
+	default:
+		v.add(path+".client_auth", "must be request or require, got %q", h.ClientAuth)
+	}
+	if h.MinTlsVersion != "1.2" && h.MinTlsVersion != "1.3" {
+		v.add(path+".min_tls_version", "must be 1.2 or 1.3, got %q", h.MinTlsVersion)
+	}
+	for i, name := range h.CipherSuites {
+		_, cipherErr := CipherSuiteIDs([]string{name})
+		if cipherErr != nil {
+			v.add(fmt.Sprintf("%v.cipher_suites.%v", path, i), "unknown or insecure cipher suite %q", name)
+		}
+	}
+	for i, name := range h.Curves {
+		if _, found := CURVES[name]; !found {
+			v.add(fmt.Sprintf("%v.curves.%v", path, i), "unknown curve %q", name)
+		}
+	}
+	if h.MaxHeaderBytes < 0 {
+		v.add(path+".max_header_bytes", "must not be negative, got %v", h.MaxHeaderBytes)
+	}
+	if h.CertRenewBefore < 0 {
+		v.add(path+".cert_renew_before", "must not be negative, got %v", h.CertRenewBefore)
+	}
+	if h.CertWarnBefore < 0 {
+		v.add(path+".cert_warn_before", "must not be negative, got %v", h.CertWarnBefore)
+	}
+	if h.TimeoutReadHeader < 0 {
+		v.add(path+".timeout_read_header", "must not be negative, got %v", h.TimeoutReadHeader)
+	}
+	v.positive(path+".timeout_read", h.TimeoutRead)
+	v.positive(path+".timeout_write", h.TimeoutWrite)
+	v.positive(path+".timeout_idle", h.TimeoutIdle)
+	if h.TlsServer != nil {
+		h.TlsServer.validate(v, path+".tls_server", allSources...)
+	}
+	if h.TlsClient != nil {
+		h.TlsClient.validate(v, path+".tls_client", allSources...)
+	}
+	if h.GlobalRateLimiter != nil {
+		h.GlobalRateLimiter.validate(v, path+".global_rate_limiter")
+	}
+}
+
+func (h *Health) validate(v *validator, path string) {
+	v.positive(path+".ping_db_timer", h.PingDbTimer)
+	v.positive(path+".heap_timer", h.HeapTimer)
+	v.positive(path+".rout_timer", h.RoutTimer)
+	v.positive(path+".routines_per_core", h.RoutinesPerCore)
+	if h.HeapSize == 0 {
+		v.add(path+".heap_size", "must be greater than zero")
+	}
+}
+
+func (t *Test) validate(v *validator, path string, d *Data) {
+	if d == nil || len(d.Relational) == 0 {
+		v.add("data.relational", "must list a database when test.db_position is used")
+		return
+	}
+	if t.Database != "" {
+		if _, found := d.Position(t.Database); !found {
+			v.add(path+".database", "no database named %q", t.Database)
+		}
+		return
+	}
+	if t.DbPosition < 0 || t.DbPosition >= len(d.Relational) {
+		v.add(path+".db_position", "no database at position %v", t.DbPosition)
+	}
+}
+
+func (c *Cache) validate(v *validator, path string) {
+	v.notEmpty(path+".host", c.Host)
+	v.port(path+".port", c.Port)
+	if c.Db < 0 {
+		v.add(path+".db", "must not be negative, got %v", c.Db)
+	}
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Watcher re-reads the layered config files whenever one of them changes, or
+// whenever the process receives SIGHUP. A new Config is only published after it
+// passes validation, so subscribers never receive a broken Config. An invalid
+// reload is logged and rejected, and the previous Config remains current.
+type Watcher struct {
+	mu          sync.Mutex
+	current     *Config
+	paths       []string
+	mtimes      map[string]time.Time
+	subscribers []func(*Config)
+	resolvers   Resolvers
+	logger      *slog.Logger
+}
+
+// NewWatcher begins with an already loaded Config, and records the current
+// modification times of the layered config files.
+func NewWatcher(cfg *Config, logger *slog.Logger) (*Watcher, error) {
+	w := &Watcher{current: cfg, logger: logger}
+	paths, pathsErr := Files()
+	if pathsErr != nil {
+		return nil, pathsErr
+	}
+	w.paths, w.mtimes = paths, modTimes(paths)
+	return w, nil
+}
+
+// Current returns the most recently published Config.
+func (w *Watcher) Current() *Config {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+// UseResolvers adds Resolvers, e.g., one for bao:// references, that are
+// applied to every reloaded Config before it is published.
+func (w *Watcher) UseResolvers(rs Resolvers) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.resolvers = rs
+}
+
+// Subscribe registers a func that receives every valid Config published after
+// a reload. Subscribers are invoked in the order they were registered, and
+// should return quickly.
+func (w *Watcher) Subscribe(fn func(*Config)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subscribers = append(w.subscribers, fn)
+}
+
+// Reload reads and validates the config files, then publishes the new Config
+// to every subscriber. The error of an invalid reload is returned, and nothing
+// is published.
+func (w *Watcher) Reload() error {
+	paths, pathsErr := Files()
+	if pathsErr != nil {
+		return pathsErr
+	}
+
+	cfg, cfgErr := LoadFiles(paths...)
+	if cfgErr != nil {
+		return cfgErr
+	}
+
+	w.mu.Lock()
+	resolvers := w.resolvers
+	w.mu.Unlock()
+
+	refErr := cfg.ResolveRefs(resolvers)
+	if refErr != nil {
+		return refErr
+	}
+
+	w.mu.Lock()
+	w.current = cfg
+	w.paths, w.mtimes = paths, modTimes(paths)
+	subscribers := slices.Clone(w.subscribers)
+	w.mu.Unlock()
+
+	for _, fn := range subscribers {
+		fn(cfg)
+	}
+	return nil
+}
+
+// Watch polls the modification times of the config files every interval, and
+// listens for SIGHUP. Either one triggers a Reload. It blocks until the
+// context is cancelled.
+func (w *Watcher) Watch(ctx context.Context, interval time.Duration) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			w.reload("SIGHUP")
+		case <-ticker.C:
+			if w.changed() {
+				w.reload("file changed")
+			}
+		}
+	}
+}
+
+func (w *Watcher) reload(reason string) {
+	err := w.Reload()
+	if err != nil {
+		w.logger.Error("Config reload rejected", "reason", reason, "ERR:", err.Error())
+		return
+	}
+	w.logger.Info("Config reloaded", "reason", reason)
+}
+
+// changed reports whether a config file was modified, created, or removed.
+func (w *Watcher) changed() bool {
+	paths, pathsErr := Files()
+	if pathsErr != nil {
+		return false
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// When an update is rejected, remember the new times to avoid retrying
+	// the same broken file on every tick.
+	mtimes := modTimes(paths)
+	if slices.Equal(paths, w.paths) && sameTimes(mtimes, w.mtimes) {
+		return false
+	}
+	w.paths, w.mtimes = paths, mtimes
+	return true
+}
+
+func modTimes(paths []string) map[string]time.Time {
+	mtimes := make(map[string]time.Time, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err == nil {
+			mtimes[path] = info.ModTime()
+		}
+	}
+	return mtimes
+}
+
+func sameTimes(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if !b[k].Equal(v) {
+			return false
+		}
+	}
+	return true
+}
@@ -10,43 +10,53 @@ import (
 	"github.com/Shoowa/vamos/secrets"
 )
 
-func readPassword(c *secrets.SkeletonKey, cfg *config.Cache) string {
-	secret, secretErr := c.ReadPathAndKey(cfg.Secret, cfg.SecretKey)
-	if secretErr != nil {
-		return ""
-	}
-	return secret
+func readPassword(ctx context.Context, c secrets.Provider, cfg *config.Cache) (string, error) {
+	return c.ReadKey(ctx, cfg.SecretMount, cfg.Secret, cfg.SecretKey)
 }
 
-func configure(cfg *config.Config, sec *secrets.SkeletonKey) (*redis.Options, error) {
+func configure(cfg *config.Config, sec secrets.Provider) (*redis.Options, error) {
 	hostAndPort := fmt.Sprintf("%v:%v", cfg.Cache.Host, cfg.Cache.Port)
 
 	opts := &redis.Options{
 		DB:   cfg.Cache.Db,
 		Addr: hostAndPort,
 		CredentialsProviderContext: func(ctx context.Context) (string, string, error) {
-			return cfg.Cache.User, readPassword(sec, cfg.Cache), nil
+			pw, pwErr := readPassword(ctx, sec, cfg.Cache)
+			return cfg.Cache.User, pw, pwErr
 		},
 	}
 
 	if cfg.Cache.Sslmode == true {
-		redisTLS, rtlsErr := sec.ConfigureTLSwithCA(cfg.HttpServer)
+		redisTLS, rtlsErr := secrets.ClientTLS(sec, cfg.HttpServer)
 		if rtlsErr != nil {
 			return nil, rtlsErr
 		}
 		opts.TLSConfig = redisTLS
 	}
 
+	// A Provider reporting changes re-authenticates every pooled connection
+	// with the new password instead. The subscription starts last, so a
+	// failure above leaves none behind.
+	if n, isNotifier := sec.(secrets.Notifier); isNotifier {
+		opts.StreamingCredentialsProvider = watchPassword(n, cfg.Cache)
+	}
+
 	return opts, nil
 }
 
 // CreateClient provides a Redis client configured with TLS, and an ability to
-// retrieve a password at any time from the secrets storage.
-func CreateClient(cfg *config.Config, sec *secrets.SkeletonKey) (*redis.Client, error) {
+// retrieve a password at any time from the secrets storage. When the Provider
+// is a secrets.Notifier, connections in the pool authenticate again after the
+// password changes. Release the client with Close, so the watch ends.
+func CreateClient(cfg *config.Config, sec secrets.Provider) (*redis.Client, error) {
 	opts, confErr := configure(cfg, sec)
 	if confErr != nil {
 		return nil, confErr
 	}
 
-	return redis.NewClient(opts), nil
+	client := redis.NewClient(opts)
+	if r, isRotating := opts.StreamingCredentialsProvider.(*rotatingCreds); isRotating {
+		watches.Store(client, r.stop)
+	}
+	return client, nil
 }
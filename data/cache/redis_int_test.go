@@ -25,7 +25,8 @@ func Test_ConnectCache(t *testing.T) {
 	t.Setenv("APP_ENV", "DEV")
 	t.Setenv("OPENBAO_TOKEN", "token")
 
-	cfg := config.Read()
+	cfg, cfgErr := config.Read()
+	Ok(t, cfgErr)
 	sk := new(secrets.SkeletonKey)
 	sk.Create(cfg)
 
@@ -38,5 +39,5 @@ func Test_ConnectCache(t *testing.T) {
 
 	Equals(t, "PONG", pong)
 
-	t.Cleanup(func() { cache.Close() })
+	t.Cleanup(func() { Close(cache) })
 }
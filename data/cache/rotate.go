@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	redis "github.com/redis/go-redis/v9"
+	"github.com/redis/go-redis/v9/auth"
+
+	"github.com/Shoowa/vamos/config"
+	"github.com/Shoowa/vamos/secrets"
+)
+
+// watches associates a client with its subscription to changes of the
+// password, so that Close can end it.
+var watches sync.Map
+
+// rotatingCreds streams the password to the Redis client. Every pooled
+// connection subscribes while it lives, and authenticates again whenever the
+// secret holding the password changes.
+type rotatingCreds struct {
+	sec    secrets.Provider
+	cfg    *config.Cache
+	logger *slog.Logger
+	stop   func()
+
+	mu        sync.Mutex
+	listeners map[auth.CredentialsListener]struct{}
+}
+
+func watchPassword(n secrets.Notifier, cfg *config.Cache) *rotatingCreds {
+	r := &rotatingCreds{
+		sec:       n,
+		cfg:       cfg,
+		logger:    slog.Default().With("secret", cfg.Secret),
+		listeners: map[auth.CredentialsListener]struct{}{},
+	}
+	r.stop = n.OnChange(cfg.SecretMount, cfg.Secret, r.rotate)
+	return r
+}
+
+// Subscribe fulfills auth.StreamingCredentialsProvider.
+func (r *rotatingCreds) Subscribe(listener auth.CredentialsListener) (auth.Credentials, auth.UnsubscribeFunc, error) {
+	pw, pwErr := readPassword(context.Background(), r.sec, r.cfg)
+	if pwErr != nil {
+		return nil, nil, pwErr
+	}
+
+	r.mu.Lock()
+	r.listeners[listener] = struct{}{}
+	r.mu.Unlock()
+
+	unsubscribe := func() error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.listeners, listener)
+		return nil
+	}
+	return auth.NewBasicCredentials(r.cfg.User, pw), unsubscribe, nil
+}
+
+// rotate reads the new password, and hands it to every pooled connection.
+func (r *rotatingCreds) rotate(change secrets.SecretChange) {
+	pw, pwErr := readPassword(context.Background(), r.sec, r.cfg)
+	if pwErr != nil {
+		r.logger.Error("Redis password unreadable after it changed", "ERR:", pwErr.Error())
+		return
+	}
+
+	r.mu.Lock()
+	listeners := make([]auth.CredentialsListener, 0, len(r.listeners))
+	for listener := range r.listeners {
+		listeners = append(listeners, listener)
+	}
+	r.mu.Unlock()
+
+	creds := auth.NewBasicCredentials(r.cfg.User, pw)
+	for _, listener := range listeners {
+		listener.OnNext(creds)
+	}
+	r.logger.Info("Redis connections authenticated again after the password changed", "version", change.Version, "connections", len(listeners))
+}
+
+// Close closes the client, and stops watching its password.
+func Close(client *redis.Client) error {
+	stop, found := watches.LoadAndDelete(client)
+	if found {
+		stop.(func())()
+	}
+	return client.Close()
+}
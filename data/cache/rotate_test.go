@@ -0,0 +1,37 @@
+//go:build !integration
+
+package cache_test
+
+import (
+	"testing"
+
+	"github.com/Shoowa/vamos/config"
+	. "github.com/Shoowa/vamos/data/cache"
+	"github.com/Shoowa/vamos/secrets"
+	. "github.com/Shoowa/vamos/testhelper"
+)
+
+// countingNotifier reports no changes, and counts its live subscriptions.
+type countingNotifier struct {
+	*secrets.MemoryProvider
+	subscribed int
+}
+
+func (c *countingNotifier) OnChange(mount, secretPath string, fn func(secrets.SecretChange)) func() {
+	c.subscribed++
+	return func() { c.subscribed-- }
+}
+
+func Test_Close(t *testing.T) {
+	n := &countingNotifier{MemoryProvider: secrets.NewMemoryProvider()}
+	n.Set("", "redis", "password", "hunter2")
+	cfg := &config.Config{Cache: &config.Cache{Host: "127.0.0.1", Port: "1", Secret: "redis", SecretKey: "password"}}
+
+	// Creating a client doesn't connect.
+	client, clientErr := CreateClient(cfg, n)
+	Ok(t, clientErr)
+	Equals(t, 1, n.subscribed)
+
+	Ok(t, Close(client))
+	Equals(t, 0, n.subscribed)
+}
@@ -0,0 +1,296 @@
+package rdbms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Shoowa/vamos/config"
+	"github.com/Shoowa/vamos/metrics"
+)
+
+const (
+	// BALANCE_ROUND_ROBIN takes turns among the healthy replicas.
+	BALANCE_ROUND_ROBIN = "round_robin"
+	// BALANCE_LEAST_CONNS picks the healthy replica with the fewest acquired
+	// connections.
+	BALANCE_LEAST_CONNS = "least_connections"
+	// CLUSTER_CHECK_INTERVAL is the time between checks of the replicas.
+	CLUSTER_CHECK_INTERVAL = time.Second * 5
+)
+
+// replicaLag is zero on a streaming replica that replayed everything it
+// received, so an idle primary doesn't look like lag. A replica that isn't
+// streaming may have received nothing lately, so its lag is the age of the last
+// replayed transaction, or NULL when it replayed none.
+const replicaLag = `SELECT CASE
+	WHEN NOT pg_is_in_recovery() THEN 0
+	WHEN EXISTS (SELECT 1 FROM pg_stat_wal_receiver WHERE status = 'streaming')
+		AND pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())
+END::float8`
+
+// routes counts the queries & transactions a Cluster sent to each target.
+var routes = metrics.CreateCounterVec(
+	"vamos", "rdbms", "cluster_routes_total",
+	"Amount of queries & transactions routed, by cluster & target.",
+	[]string{"cluster", "target"},
+)
+
+// DBTX is the interface generated by sqlc for pgx. A *pgxpool.Pool, a pgx.Tx,
+// and a Cluster fulfill it.
+type DBTX interface {
+	Exec(context.Context, string, ...any) (pgconn.CommandTag, error)
+	Query(context.Context, string, ...any) (pgx.Rows, error)
+	QueryRow(context.Context, string, ...any) pgx.Row
+}
+
+// Replica is a read-only member of a Cluster.
+type Replica struct {
+	Name string
+	// Pool is nil when the replica never opened. It is then always unhealthy.
+	Pool *pgxpool.Pool
+	// MaxLag is how far the replica may trail the primary. Zero ignores lag.
+	MaxLag time.Duration
+
+	healthy atomic.Bool
+}
+
+// Cluster routes writes to a primary, and read-only queries & transactions to
+// healthy replicas. Without a healthy replica, reads fall back to the primary.
+type Cluster struct {
+	name     string
+	primary  *pgxpool.Pool
+	replicas []*Replica
+	balance  string
+	next     atomic.Uint64
+}
+
+// ClusterOption allows us to selectively configure the Cluster.
+type ClusterOption func(*Cluster)
+
+// WithBalance chooses BALANCE_ROUND_ROBIN, the default, or BALANCE_LEAST_CONNS.
+func WithBalance(balance string) ClusterOption {
+	return func(c *Cluster) {
+		c.balance = balance
+	}
+}
+
+// NewCluster combines a primary & its replicas. Replicas with a pool are
+// considered healthy until the first Check.
+func NewCluster(name string, primary *pgxpool.Pool, replicas []*Replica, options ...ClusterOption) (*Cluster, error) {
+	if primary == nil {
+		return nil, fmt.Errorf("Cluster %v lacks a primary.", name)
+	}
+	c := &Cluster{
+		name:     name,
+		primary:  primary,
+		replicas: replicas,
+		balance:  BALANCE_ROUND_ROBIN,
+	}
+	for _, opt := range options {
+		opt(c)
+	}
+	if c.balance != BALANCE_ROUND_ROBIN && c.balance != BALANCE_LEAST_CONNS {
+		return nil, fmt.Errorf("Unknown balance %q.", c.balance)
+	}
+	for _, r := range replicas {
+		r.healthy.Store(r.Pool != nil)
+	}
+	return c, nil
+}
+
+// OpenCluster assembles a Cluster from the pools of a Registry, following the
+// role & cluster declared by each database. The primary must have opened. A
+// replica that failed to open is kept, but never chosen.
+func OpenCluster(cfg *config.Config, registry *Registry, name string, options ...ClusterOption) (*Cluster, error) {
+	primaryName, replicaNames := cfg.Data.Cluster(name)
+	if primaryName == "" {
+		return nil, fmt.Errorf("Cluster %v lacks a primary.", name)
+	}
+	primary, primaryErr := registry.Get(primaryName)
+	if primaryErr != nil {
+		return nil, primaryErr
+	}
+
+	replicas := []*Replica{}
+	for _, replicaName := range replicaNames {
+		position, _ := cfg.Data.Position(replicaName)
+		pool, _ := registry.Get(replicaName)
+		replicas = append(replicas, &Replica{
+			Name:   replicaName,
+			Pool:   pool,
+			MaxLag: time.Second * time.Duration(cfg.Data.Relational[position].MaxLag),
+		})
+	}
+	return NewCluster(name, primary, replicas, options...)
+}
+
+// Primary returns the pool accepting writes.
+func (c *Cluster) Primary() *pgxpool.Pool {
+	return c.primary
+}
+
+// Reader returns a healthy replica, or the primary when none is healthy.
+func (c *Cluster) Reader() *pgxpool.Pool {
+	healthy := make([]*Replica, 0, len(c.replicas))
+	for _, r := range c.replicas {
+		if r.healthy.Load() {
+			healthy = append(healthy, r)
+		}
+	}
+	if len(healthy) == 0 {
+		routes.WithLabelValues(c.name, "fallback").Inc()
+		return c.primary
+	}
+
+	chosen := healthy[0]
+	switch c.balance {
+	case BALANCE_LEAST_CONNS:
+		for _, r := range healthy[1:] {
+			if r.Pool.Stat().AcquiredConns() < chosen.Pool.Stat().AcquiredConns() {
+				chosen = r
+			}
+		}
+	default:
+		chosen = healthy[(c.next.Add(1)-1)%uint64(len(healthy))]
+	}
+	routes.WithLabelValues(c.name, "replica").Inc()
+	return chosen.Pool
+}
+
+// Healthy lists the names of the replicas that may serve reads.
+func (c *Cluster) Healthy() []string {
+	names := []string{}
+	for _, r := range c.replicas {
+		if r.healthy.Load() {
+			names = append(names, r.Name)
+		}
+	}
+	return names
+}
+
+type readOnlyKey struct{}
+
+// ReadOnly marks a context, so that Query & QueryRow of a Cluster are sent to
+// a replica. Use it for queries that tolerate replica lag.
+func ReadOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readOnlyKey{}, true)
+}
+
+func isReadOnly(ctx context.Context) bool {
+	readOnly, _ := ctx.Value(readOnlyKey{}).(bool)
+	return readOnly
+}
+
+// route chooses the pool of a query.
+func (c *Cluster) route(ctx context.Context) *pgxpool.Pool {
+	if isReadOnly(ctx) {
+		return c.Reader()
+	}
+	routes.WithLabelValues(c.name, "primary").Inc()
+	return c.primary
+}
+
+// Exec always runs on the primary.
+func (c *Cluster) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	routes.WithLabelValues(c.name, "primary").Inc()
+	return c.primary.Exec(ctx, sql, args...)
+}
+
+// Query runs on a replica when the context is ReadOnly, otherwise on the
+// primary.
+func (c *Cluster) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return c.route(ctx).Query(ctx, sql, args...)
+}
+
+// QueryRow runs on a replica when the context is ReadOnly, otherwise on the
+// primary.
+func (c *Cluster) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return c.route(ctx).QueryRow(ctx, sql, args...)
+}
+
+// Begin starts a transaction on the primary.
+func (c *Cluster) Begin(ctx context.Context) (pgx.Tx, error) {
+	return c.BeginTx(ctx, pgx.TxOptions{})
+}
+
+// BeginTx starts a READ ONLY transaction on a replica, and any other
+// transaction on the primary.
+func (c *Cluster) BeginTx(ctx context.Context, opts pgx.TxOptions) (pgx.Tx, error) {
+	if opts.AccessMode == pgx.ReadOnly {
+		return c.Reader().BeginTx(ctx, opts)
+	}
+	routes.WithLabelValues(c.name, "primary").Inc()
+	return c.primary.BeginTx(ctx, opts)
+}
+
+// Check pings every replica & measures its lag. A replica that fails, or
+// trails the primary by more than its MaxLag, is avoided until a later Check
+// succeeds. The failures are joined in the error.
+func (c *Cluster) Check(ctx context.Context) error {
+	errs := make([]error, len(c.replicas))
+	var wg sync.WaitGroup
+	for i, r := range c.replicas {
+		wg.Go(func() {
+			errs[i] = r.check(ctx)
+			r.healthy.Store(errs[i] == nil)
+		})
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (r *Replica) check(ctx context.Context) error {
+	if r.Pool == nil {
+		return fmt.Errorf("Replica %v never opened.", r.Name)
+	}
+
+	timer, cancel := context.WithTimeout(ctx, TIMEOUT_PING)
+	defer cancel()
+
+	var lag *float64
+	lagErr := r.Pool.QueryRow(timer, replicaLag).Scan(&lag)
+	if lagErr != nil {
+		return fmt.Errorf("Replica %v failed: %w", r.Name, lagErr)
+	}
+	if lag == nil {
+		if r.MaxLag > 0 {
+			return fmt.Errorf("Replica %v isn't streaming, and replayed nothing yet.", r.Name)
+		}
+		return nil
+	}
+	behind := time.Duration(*lag * float64(time.Second))
+	if r.MaxLag > 0 && behind > r.MaxLag {
+		return fmt.Errorf("Replica %v lags %v behind the primary.", r.Name, behind)
+	}
+	return nil
+}
+
+// Monitor checks the replicas every CLUSTER_CHECK_INTERVAL until the context
+// is cancelled.
+func (c *Cluster) Monitor(ctx context.Context, logger *slog.Logger) {
+	ticker := time.NewTicker(CLUSTER_CHECK_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		checkErr := c.Check(ctx)
+		if checkErr != nil {
+			logger.Warn("Replica check failed", "cluster", c.name, "healthy", c.Healthy(), "ERR:", checkErr.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,58 @@
+//go:build !integration
+
+package rdbms_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	. "github.com/Shoowa/vamos/data/rdbms"
+	. "github.com/Shoowa/vamos/testhelper"
+)
+
+// lazyPool doesn't connect until it is used, and can't connect at all.
+func lazyPool(t *testing.T, host string) *pgxpool.Pool {
+	pool, err := pgxpool.New(context.Background(), "host="+host+" port=1 user=app database=app connect_timeout=1")
+	Ok(t, err)
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func Test_Cluster_Routing(t *testing.T) {
+	primary := lazyPool(t, "primary")
+	first, second := lazyPool(t, "first"), lazyPool(t, "second")
+	replicas := []*Replica{
+		{Name: "first", Pool: first},
+		{Name: "second", Pool: second},
+		{Name: "closed"},
+	}
+
+	cluster, err := NewCluster("orders", primary, replicas)
+	Ok(t, err)
+	var _ DBTX = cluster
+
+	// The replica that never opened is skipped.
+	Equals(t, []string{"first", "second"}, cluster.Healthy())
+	Assert(t, cluster.Reader() == first, "Expected the first replica.")
+	Assert(t, cluster.Reader() == second, "Expected the second replica.")
+	Assert(t, cluster.Reader() == first, "Expected to return to the first replica.")
+	Assert(t, cluster.Primary() == primary, "Expected the primary.")
+
+	// With equal load, the least connections balance keeps the first replica.
+	least, leastErr := NewCluster("orders", primary, replicas[:2], WithBalance(BALANCE_LEAST_CONNS))
+	Ok(t, leastErr)
+	Assert(t, least.Reader() == first, "Expected the first replica.")
+	Assert(t, least.Reader() == first, "Expected the first replica again.")
+
+	// Unreachable replicas fail their check, so reads fall back to the primary.
+	Assert(t, cluster.Check(context.Background()) != nil, "Expected the check to fail.")
+	Equals(t, []string{}, cluster.Healthy())
+	Assert(t, cluster.Reader() == primary, "Expected a fallback to the primary.")
+
+	_, balanceErr := NewCluster("orders", primary, nil, WithBalance("random"))
+	Assert(t, balanceErr != nil, "Expected an unknown balance to fail.")
+	_, primaryErr := NewCluster("orders", nil, replicas)
+	Assert(t, primaryErr != nil, "Expected a missing primary to fail.")
+}
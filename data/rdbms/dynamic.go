@@ -0,0 +1,185 @@
+package rdbms
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	openbao "github.com/openbao/openbao/api/v2"
+
+	"github.com/Shoowa/vamos/config"
+	"github.com/Shoowa/vamos/secrets"
+)
+
+const (
+	// LEASE_DRAIN_WAIT gives connections still using the previous credentials
+	// time to finish their work before the previous lease is revoked.
+	LEASE_DRAIN_WAIT = time.Second * 30
+	// LEASE_RETRY_WAIT is the pause between failed attempts to lease new
+	// credentials.
+	LEASE_RETRY_WAIT = time.Second * 10
+)
+
+// leases associates a pool with its dynamic credentials, so that Close can
+// revoke them.
+var leases sync.Map
+
+// dynamicCreds leases a user & password from the Openbao database secrets
+// engine. The lease is renewed while the pool lives, and replaced before it
+// expires.
+type dynamicCreds struct {
+	sk     *secrets.SkeletonKey
+	db     config.Rdb
+	logger *slog.Logger
+	stop   context.CancelFunc
+	done   chan struct{}
+
+	// drainWait is LEASE_DRAIN_WAIT, shortened by tests.
+	drainWait time.Duration
+
+	mu    sync.RWMutex
+	lease *secrets.DbLease
+}
+
+func leaseCreds(sk *secrets.SkeletonKey, db config.Rdb) (*dynamicCreds, error) {
+	lease, leaseErr := sk.DBreadCreds(db.CredsMount, db.CredsRole)
+	if leaseErr != nil {
+		return nil, leaseErr
+	}
+
+	creds := &dynamicCreds{
+		sk:        sk,
+		db:        db,
+		logger:    slog.Default().With("database", db.Database, "role", db.CredsRole),
+		done:      make(chan struct{}),
+		drainWait: LEASE_DRAIN_WAIT,
+		lease:     lease,
+	}
+	return creds, nil
+}
+
+func (d *dynamicCreds) current() *secrets.DbLease {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.lease
+}
+
+// beforeConnect hands the current credentials to every new connection.
+func (d *dynamicCreds) beforeConnect(ctx context.Context, cc *pgx.ConnConfig) error {
+	lease := d.current()
+	cc.User = lease.Username
+	cc.Password = lease.Password
+	return nil
+}
+
+// start launches the renewal of the lease in the background.
+func (d *dynamicCreds) start(pool *pgxpool.Pool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	d.stop = cancel
+	go d.maintain(ctx, pool)
+}
+
+// maintain renews the lease until it can't be renewed any further. Then new
+// credentials are leased, the pool is drained, so idle connections close and
+// busy connections close once released, and the previous lease is revoked.
+func (d *dynamicCreds) maintain(ctx context.Context, pool *pgxpool.Pool) {
+	defer close(d.done)
+
+	for {
+		if !d.renewUntilDone(ctx) {
+			return
+		}
+
+		previous := d.current()
+		next, ok := d.leaseUntilDone(ctx)
+		if !ok {
+			return
+		}
+
+		d.mu.Lock()
+		d.lease = next
+		d.mu.Unlock()
+		pool.Reset()
+		d.logger.Info("Postgres credentials rotated")
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(d.drainWait):
+		}
+		d.revoke(previous)
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// renewUntilDone returns true when the lease can't be renewed any further, and
+// false when the context is cancelled.
+func (d *dynamicCreds) renewUntilDone(ctx context.Context) bool {
+	input := &openbao.LifetimeWatcherInput{Secret: d.current().Secret}
+	watcher, watcherErr := d.sk.Openbao.NewLifetimeWatcher(input)
+	if watcherErr != nil {
+		d.logger.Error("Postgres lease watcher failed", "ERR:", watcherErr.Error())
+		return true
+	}
+	go watcher.Start()
+	defer watcher.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case err := <-watcher.DoneCh():
+			if err != nil {
+				d.logger.Warn("Postgres lease renewal stopped", "ERR:", err.Error())
+			}
+			return true
+		case <-watcher.RenewCh():
+			d.logger.Debug("Postgres lease renewed")
+		}
+	}
+}
+
+func (d *dynamicCreds) leaseUntilDone(ctx context.Context) (*secrets.DbLease, bool) {
+	for {
+		lease, err := d.sk.DBreadCredsContext(ctx, d.db.CredsMount, d.db.CredsRole)
+		if err == nil {
+			return lease, true
+		}
+		d.logger.Error("Postgres credentials unavailable", "ERR:", err.Error())
+
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-time.After(LEASE_RETRY_WAIT):
+		}
+	}
+}
+
+func (d *dynamicCreds) revoke(lease *secrets.DbLease) error {
+	err := d.sk.RevokeLease(lease.LeaseId)
+	if err != nil {
+		d.logger.Error("Postgres lease revocation failed", "ERR:", err.Error())
+	}
+	return err
+}
+
+// Close closes the pool, and stops watching its password. When the pool leased
+// dynamic credentials, their renewal stops and the lease is revoked afterwards.
+func Close(pool *pgxpool.Pool) error {
+	unwatchPassword(pool)
+	value, found := leases.LoadAndDelete(pool)
+	pool.Close()
+	if !found {
+		return nil
+	}
+
+	d := value.(*dynamicCreds)
+	d.stop()
+	<-d.done
+	return d.revoke(d.current())
+}
@@ -0,0 +1,137 @@
+//go:build !integration
+
+package rdbms
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	openbao "github.com/openbao/openbao/api/v2"
+
+	"github.com/Shoowa/vamos/config"
+	"github.com/Shoowa/vamos/secrets"
+)
+
+// fakeDatabaseEngine stands in for the database secrets engine. Its leases last
+// a second, and can't be renewed, so they rotate quickly.
+type fakeDatabaseEngine struct {
+	mu      sync.Mutex
+	issued  int
+	revoked []string
+}
+
+func (f *fakeDatabaseEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/v1/database/creds/app":
+		f.issued++
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"lease_id":       fmt.Sprintf("database/creds/app/%v", f.issued),
+			"lease_duration": 1,
+			"renewable":      true,
+			"data": map[string]any{
+				"username": fmt.Sprintf("v-app-%v", f.issued),
+				"password": "pw",
+			},
+		})
+	case "/v1/sys/leases/renew":
+		http.Error(w, `{"errors":["lease is not renewable"]}`, http.StatusBadRequest)
+	case "/v1/sys/leases/revoke":
+		body := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.revoked = append(f.revoked, body["lease_id"])
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeDatabaseEngine) revocations() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.revoked)
+}
+
+func username(t *testing.T, d *dynamicCreds) string {
+	cc := &pgx.ConnConfig{}
+	err := d.beforeConnect(context.Background(), cc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cc.User
+}
+
+func Test_DynamicCreds(t *testing.T) {
+	engine := new(fakeDatabaseEngine)
+	srv := httptest.NewServer(engine)
+	t.Cleanup(srv.Close)
+
+	obCfg := openbao.DefaultConfig()
+	obCfg.Address = srv.URL
+	client, clientErr := openbao.NewClient(obCfg)
+	if clientErr != nil {
+		t.Fatal(clientErr)
+	}
+	sk := &secrets.SkeletonKey{Openbao: client}
+
+	// A pool without MinConns doesn't connect until a query needs it.
+	poolCfg, poolCfgErr := pgxpool.ParseConfig("host=127.0.0.1 port=1 database=app")
+	if poolCfgErr != nil {
+		t.Fatal(poolCfgErr)
+	}
+	pool, poolErr := pgxpool.NewWithConfig(context.Background(), poolCfg)
+	if poolErr != nil {
+		t.Fatal(poolErr)
+	}
+
+	creds, credsErr := leaseCreds(sk, config.Rdb{Database: "app", CredsMount: "database", CredsRole: "app"})
+	if credsErr != nil {
+		t.Fatal(credsErr)
+	}
+	if got := username(t, creds); got != "v-app-1" {
+		t.Fatalf("Expected the first lease, got %v.", got)
+	}
+
+	// The previous lease survives until the drain ends, or the pool closes.
+	creds.drainWait = time.Hour
+	creds.start(pool)
+	leases.Store(pool, creds)
+
+	deadline := time.Now().Add(time.Second * 5)
+	for username(t, creds) == "v-app-1" {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the lease to rotate after it expired.")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	if got := username(t, creds); got != "v-app-2" {
+		t.Fatalf("Expected new connections to use the second lease, got %v.", got)
+	}
+	if revoked := engine.revocations(); len(revoked) != 0 {
+		t.Fatalf("Expected no revocation while draining, got %v.", revoked)
+	}
+
+	closeErr := Close(pool)
+	if closeErr != nil {
+		t.Fatal(closeErr)
+	}
+	want := []string{"database/creds/app/1", "database/creds/app/2"}
+	if revoked := engine.revocations(); !slices.Equal(want, revoked) {
+		t.Fatalf("Expected Close to revoke %v, got %v.", want, revoked)
+	}
+	if _, found := leases.Load(pool); found {
+		t.Fatal("Expected Close to forget the pool.")
+	}
+}
@@ -0,0 +1,257 @@
+package rdbms
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/Shoowa/vamos/secrets"
+)
+
+const (
+	// DATA_KEY_TTL limits how long a single data key encrypts new values.
+	DATA_KEY_TTL = time.Hour
+	// DATA_KEY_CACHE limits how many unwrapped data keys are kept for reading.
+	DATA_KEY_CACHE = 1024
+	// ENVELOPE_VERSION is the first byte of every sealed value.
+	ENVELOPE_VERSION byte = 1
+)
+
+// Cipher encrypts column values with envelope encryption. A data key generated
+// by the Openbao Transit Engine encrypts values locally with AES-GCM, and the
+// data key, wrapped by a Transit key, is stored beside each value. Unwrapped
+// data keys are cached, so reading many rows doesn't cost a round-trip each.
+type Cipher struct {
+	sk      *secrets.SkeletonKey
+	keyName string
+
+	mu      sync.Mutex
+	current *envelopeKey
+	keys    map[string]cipher.AEAD
+	group   singleflight.Group
+}
+
+type envelopeKey struct {
+	wrapped string
+	aead    cipher.AEAD
+	expires time.Time
+}
+
+// NewCipher uses the named Transit key to wrap data keys.
+func NewCipher(sk *secrets.SkeletonKey, keyName string) *Cipher {
+	return &Cipher{
+		sk:      sk,
+		keyName: keyName,
+		keys:    map[string]cipher.AEAD{},
+	}
+}
+
+// Seal encrypts a value. The result holds the version, the wrapped data key,
+// the nonce, and the ciphertext.
+func (c *Cipher) Seal(plaintext []byte) ([]byte, error) {
+	key, keyErr := c.writeKey()
+	if keyErr != nil {
+		return nil, keyErr
+	}
+
+	nonce := make([]byte, key.aead.NonceSize())
+	_, randErr := rand.Read(nonce)
+	if randErr != nil {
+		return nil, randErr
+	}
+
+	sealed := []byte{ENVELOPE_VERSION}
+	sealed = binary.BigEndian.AppendUint16(sealed, uint16(len(key.wrapped)))
+	sealed = append(sealed, key.wrapped...)
+	sealed = append(sealed, nonce...)
+	return key.aead.Seal(sealed, nonce, plaintext, nil), nil
+}
+
+// Open decrypts a value created by Seal.
+func (c *Cipher) Open(sealed []byte) ([]byte, error) {
+	if len(sealed) < 3 || sealed[0] != ENVELOPE_VERSION {
+		return nil, errors.New("Encrypted value has an unknown format.")
+	}
+	size := int(binary.BigEndian.Uint16(sealed[1:3]))
+	if len(sealed) < 3+size {
+		return nil, errors.New("Encrypted value is truncated.")
+	}
+	wrapped := string(sealed[3 : 3+size])
+
+	aead, keyErr := c.readKey(wrapped)
+	if keyErr != nil {
+		return nil, keyErr
+	}
+
+	rest := sealed[3+size:]
+	if len(rest) < aead.NonceSize() {
+		return nil, errors.New("Encrypted value is truncated.")
+	}
+	nonce, ciphertext := rest[:aead.NonceSize()], rest[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+// writeKey returns the data key for new values, and generates another one
+// after DATA_KEY_TTL. Concurrent writers share a single request, made without
+// holding the lock, so reads aren't blocked by the round-trip.
+func (c *Cipher) writeKey() (*envelopeKey, error) {
+	c.mu.Lock()
+	current := c.current
+	c.mu.Unlock()
+	if current != nil && time.Now().Before(current.expires) {
+		return current, nil
+	}
+
+	// The name of the flight can't collide with a wrapped key, which starts
+	// with "vault:".
+	generated, err, _ := c.group.Do("datakey", func() (any, error) {
+		dataKey, dataKeyErr := c.sk.DataKey(c.sk.DataKeyDraftPayload(c.keyName))
+		if dataKeyErr != nil {
+			return nil, dataKeyErr
+		}
+		aead, aeadErr := newAead(dataKey.Plaintext)
+		if aeadErr != nil {
+			return nil, aeadErr
+		}
+
+		key := &envelopeKey{dataKey.Ciphertext, aead, time.Now().Add(DATA_KEY_TTL)}
+		c.mu.Lock()
+		c.current = key
+		c.remember(dataKey.Ciphertext, aead)
+		c.mu.Unlock()
+		return key, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return generated.(*envelopeKey), nil
+}
+
+// readKey unwraps a data key through the Transit Engine, unless it is cached.
+// Concurrent reads of the same key share a single request.
+func (c *Cipher) readKey(wrapped string) (cipher.AEAD, error) {
+	c.mu.Lock()
+	aead, found := c.keys[wrapped]
+	c.mu.Unlock()
+	if found {
+		return aead, nil
+	}
+
+	unwrapped, err, _ := c.group.Do(wrapped, func() (any, error) {
+		raw, decryptErr := c.sk.Decrypt(c.sk.DecryptDraftPayload(c.keyName, wrapped))
+		if decryptErr != nil {
+			return nil, decryptErr
+		}
+		aead, aeadErr := newAead(raw)
+		if aeadErr != nil {
+			return nil, aeadErr
+		}
+
+		c.mu.Lock()
+		c.remember(wrapped, aead)
+		c.mu.Unlock()
+		return aead, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return unwrapped.(cipher.AEAD), nil
+}
+
+// remember caches an unwrapped key. The cache is emptied when it is full. The
+// caller holds the lock.
+func (c *Cipher) remember(wrapped string, aead cipher.AEAD) {
+	if len(c.keys) >= DATA_KEY_CACHE {
+		clear(c.keys)
+	}
+	c.keys[wrapped] = aead
+}
+
+func newAead(key []byte) (cipher.AEAD, error) {
+	block, blockErr := aes.NewCipher(key)
+	if blockErr != nil {
+		return nil, blockErr
+	}
+	return cipher.NewGCM(block)
+}
+
+var defaultCipher atomic.Pointer[Cipher]
+
+// UseCipher chooses the Cipher used by every Encrypted value. It must be set
+// before an Encrypted value is written or scanned.
+func UseCipher(c *Cipher) {
+	defaultCipher.Store(c)
+}
+
+// Encrypted wraps a value that is encrypted before it is written to Postgres,
+// and decrypted when it is scanned, using the Cipher set by UseCipher. The
+// value is encoded as JSON, and stored in a bytea column. A NULL column scans
+// into the zero value.
+//
+// Map a column to it in sqlc.yaml, so generated queries need no changes.
+//
+//	overrides:
+//	  - column: "authors.phone"
+//	    go_type:
+//	      import: "github.com/Shoowa/vamos/data/rdbms"
+//	      type: "Encrypted[string]"
+type Encrypted[T any] struct {
+	Plain T
+}
+
+// Encrypt is a convenient constructor.
+func Encrypt[T any](v T) Encrypted[T] {
+	return Encrypted[T]{Plain: v}
+}
+
+// Value fulfills driver.Valuer.
+func (e Encrypted[T]) Value() (driver.Value, error) {
+	c := defaultCipher.Load()
+	if c == nil {
+		return nil, errors.New("No Cipher chosen for encrypted values, see UseCipher.")
+	}
+
+	plaintext, jsonErr := json.Marshal(e.Plain)
+	if jsonErr != nil {
+		return nil, jsonErr
+	}
+	return c.Seal(plaintext)
+}
+
+// Scan fulfills sql.Scanner.
+func (e *Encrypted[T]) Scan(src any) error {
+	var sealed []byte
+	switch v := src.(type) {
+	case nil:
+		var zero T
+		e.Plain = zero
+		return nil
+	case []byte:
+		sealed = v
+	case string:
+		sealed = []byte(v)
+	default:
+		return fmt.Errorf("Can't scan %T into an encrypted value.", src)
+	}
+
+	c := defaultCipher.Load()
+	if c == nil {
+		return errors.New("No Cipher chosen for encrypted values, see UseCipher.")
+	}
+
+	plaintext, openErr := c.Open(sealed)
+	if openErr != nil {
+		return openErr
+	}
+	return json.Unmarshal(plaintext, &e.Plain)
+}
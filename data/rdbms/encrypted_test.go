@@ -0,0 +1,89 @@
+//go:build !integration
+
+package rdbms_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	openbao "github.com/openbao/openbao/api/v2"
+
+	. "github.com/Shoowa/vamos/data/rdbms"
+	"github.com/Shoowa/vamos/secrets"
+	. "github.com/Shoowa/vamos/testhelper"
+)
+
+func Test_Encrypted(t *testing.T) {
+	rawKey := bytes.Repeat([]byte{7}, 32)
+	var unwraps, generated atomic.Int32
+
+	// Stand in for the datakey & decrypt endpoints of the Transit Engine.
+	transit := func(w http.ResponseWriter, r *http.Request) {
+		data := map[string]any{}
+		switch r.URL.Path {
+		case "/v1/transit/datakey/plaintext/pii":
+			generated.Add(1)
+			data["plaintext"] = base64.StdEncoding.EncodeToString(rawKey)
+			data["ciphertext"] = "vault:v1:wrapped"
+		case "/v1/transit/decrypt/pii":
+			unwraps.Add(1)
+			data["plaintext"] = base64.StdEncoding.EncodeToString(rawKey)
+		default:
+			http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}
+	srv := httptest.NewServer(http.HandlerFunc(transit))
+	t.Cleanup(srv.Close)
+
+	obCfg := openbao.DefaultConfig()
+	obCfg.Address = srv.URL
+	client, clientErr := openbao.NewClient(obCfg)
+	Ok(t, clientErr)
+
+	UseCipher(NewCipher(&secrets.SkeletonKey{Openbao: client}, "pii"))
+
+	stored, valueErr := Encrypt("555-0100").Value()
+	Ok(t, valueErr)
+	Assert(t, !bytes.Contains(stored.([]byte), []byte("555-0100")), "Stored value holds the plaintext.")
+
+	var scanned Encrypted[string]
+	Ok(t, scanned.Scan(stored))
+	Equals(t, "555-0100", scanned.Plain)
+
+	// A fresh Cipher unwraps the data key once, then reads from its cache.
+	UseCipher(NewCipher(&secrets.SkeletonKey{Openbao: client}, "pii"))
+	for range 3 {
+		Ok(t, scanned.Scan(stored))
+	}
+	Equals(t, int32(1), unwraps.Load())
+
+	Ok(t, scanned.Scan(nil))
+	Equals(t, "", scanned.Plain)
+
+	tampered := bytes.Clone(stored.([]byte))
+	tampered[len(tampered)-1] ^= 1
+	Assert(t, scanned.Scan(tampered) != nil, "Expected an error from a tampered value.")
+
+	// Concurrent writers of a fresh Cipher share a single data key.
+	fresh := NewCipher(&secrets.SkeletonKey{Openbao: client}, "pii")
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			_, sealErr := fresh.Seal([]byte("555-0100"))
+			if sealErr != nil {
+				t.Error(sealErr)
+			}
+		})
+	}
+	wg.Wait()
+	Equals(t, int32(2), generated.Load())
+}
@@ -0,0 +1,350 @@
+package rdbms
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// MIGRATIONS_TABLE records the applied migrations. It differs from the
+	// schema_migrations table of the migrate CLI, so both can coexist.
+	MIGRATIONS_TABLE = "vamos_migrations"
+	// MIGRATE_LATEST targets the highest version found.
+	MIGRATE_LATEST = -1
+)
+
+// migrationFile matches the names written by the migrate CLI, e.g.,
+// 000001_create_authors.up.sql.
+var migrationFile = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration is a version of the schema, read from a pair of .sql files.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+	// Checksum is the SHA-256 of Up. It is recorded when the migration is
+	// applied, so a later edit of the file is noticed.
+	Checksum string
+}
+
+// MigrationStep is a migration to apply, or to revert when Revert is true.
+type MigrationStep struct {
+	Migration
+	Revert bool
+}
+
+func (s MigrationStep) String() string {
+	direction := "up"
+	if s.Revert {
+		direction = "down"
+	}
+	return fmt.Sprintf("%06d_%v %v", s.Version, s.Name, direction)
+}
+
+// MigrationStatus reports whether a migration is applied.
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// LoadMigrations reads every .up.sql & .down.sql file at the top of a
+// directory, e.g., os.DirFS("sqlc/migrations/first") or an embed.FS. Every
+// version needs an up file. A down file is optional, and needed to revert.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, dirErr := fs.ReadDir(fsys, ".")
+	if dirErr != nil {
+		return nil, dirErr
+	}
+
+	found := map[int64]*Migration{}
+	for _, entry := range entries {
+		parts := migrationFile.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || parts == nil {
+			continue
+		}
+		version, versionErr := strconv.ParseInt(parts[1], 10, 64)
+		if versionErr != nil {
+			return nil, fmt.Errorf("Migration %v has an unreadable version: %w", entry.Name(), versionErr)
+		}
+
+		sql, readErr := fs.ReadFile(fsys, entry.Name())
+		if readErr != nil {
+			return nil, readErr
+		}
+
+		m, exists := found[version]
+		if !exists {
+			m = &Migration{Version: version, Name: parts[2]}
+			found[version] = m
+		}
+		if m.Name != parts[2] {
+			return nil, fmt.Errorf("Migration %v has two names, %v & %v.", version, m.Name, parts[2])
+		}
+		if parts[3] == "up" {
+			m.Up = string(sql)
+			sum := sha256.Sum256(sql)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(sql)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(found))
+	for _, m := range found {
+		if m.Checksum == "" {
+			return nil, fmt.Errorf("Migration %v lacks an up file.", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int { return cmp.Compare(a.Version, b.Version) })
+	return migrations, nil
+}
+
+// Migrator applies migrations to a database. Each migration runs in its own
+// transaction together with its record, so a failed migration leaves nothing
+// behind. A Postgres advisory lock ensures only one process migrates at a time,
+// so every replica of a service can migrate at startup.
+type Migrator struct {
+	pool       *pgxpool.Pool
+	migrations []Migration
+	table      string
+	logger     *slog.Logger
+}
+
+// MigratorOption allows us to selectively configure the Migrator.
+type MigratorOption func(*Migrator)
+
+// WithMigrationsTable replaces MIGRATIONS_TABLE, e.g., for a second set of
+// migrations in the same database.
+func WithMigrationsTable(table string) MigratorOption {
+	return func(m *Migrator) {
+		m.table = table
+	}
+}
+
+// WithMigrationLogger logs each step.
+func WithMigrationLogger(logger *slog.Logger) MigratorOption {
+	return func(m *Migrator) {
+		m.logger = logger
+	}
+}
+
+// NewMigrator reads the migrations in a directory. It doesn't connect.
+func NewMigrator(pool *pgxpool.Pool, fsys fs.FS, options ...MigratorOption) (*Migrator, error) {
+	migrations, loadErr := LoadMigrations(fsys)
+	if loadErr != nil {
+		return nil, loadErr
+	}
+	m := &Migrator{
+		pool:       pool,
+		migrations: migrations,
+		table:      MIGRATIONS_TABLE,
+		logger:     slog.New(slog.DiscardHandler),
+	}
+	for _, opt := range options {
+		opt(m)
+	}
+	return m, nil
+}
+
+// Migrations lists the migrations read, in order.
+func (m *Migrator) Migrations() []Migration {
+	return append([]Migration{}, m.migrations...)
+}
+
+// Status reports every migration, and whether it is applied.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	conn, connErr := m.pool.Acquire(ctx)
+	if connErr != nil {
+		return nil, connErr
+	}
+	defer conn.Release()
+
+	applied, appliedErr := m.applied(ctx, conn)
+	if appliedErr != nil {
+		return nil, appliedErr
+	}
+
+	status := make([]MigrationStatus, len(m.migrations))
+	for i, migration := range m.migrations {
+		record, found := applied[migration.Version]
+		status[i] = MigrationStatus{Migration: migration, Applied: found, AppliedAt: record.at}
+	}
+	return status, nil
+}
+
+// Plan lists the steps Migrate would take to reach the target version,
+// without changing anything. It is the dry run of Migrate.
+func (m *Migrator) Plan(ctx context.Context, target int64) ([]MigrationStep, error) {
+	conn, connErr := m.pool.Acquire(ctx)
+	if connErr != nil {
+		return nil, connErr
+	}
+	defer conn.Release()
+
+	applied, appliedErr := m.applied(ctx, conn)
+	if appliedErr != nil {
+		return nil, appliedErr
+	}
+	return m.plan(applied, target)
+}
+
+// Migrate applies or reverts migrations until the schema is at the target
+// version. MIGRATE_LATEST applies every pending migration, and 0 reverts all of
+// them. It returns the steps taken, including the ones before a failure.
+func (m *Migrator) Migrate(ctx context.Context, target int64) ([]MigrationStep, error) {
+	conn, connErr := m.pool.Acquire(ctx)
+	if connErr != nil {
+		return nil, connErr
+	}
+	defer conn.Release()
+
+	_, lockErr := conn.Exec(ctx, "SELECT pg_advisory_lock(hashtext($1))", m.table)
+	if lockErr != nil {
+		return nil, lockErr
+	}
+	defer conn.Exec(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock(hashtext($1))", m.table)
+
+	table := pgx.Identifier{m.table}.Sanitize()
+	_, createErr := conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+table+` (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if createErr != nil {
+		return nil, createErr
+	}
+
+	// Read the records after the lock, so another process' work is seen.
+	applied, appliedErr := m.applied(ctx, conn)
+	if appliedErr != nil {
+		return nil, appliedErr
+	}
+	steps, planErr := m.plan(applied, target)
+	if planErr != nil {
+		return nil, planErr
+	}
+
+	taken := []MigrationStep{}
+	for _, step := range steps {
+		stepErr := WithTx(ctx, conn, TxOptions{Name: "migration", MaxAttempts: 1}, func(tx pgx.Tx) error {
+			if step.Revert {
+				_, downErr := tx.Exec(ctx, step.Down)
+				if downErr != nil {
+					return downErr
+				}
+				_, deleteErr := tx.Exec(ctx, "DELETE FROM "+table+" WHERE version = $1", step.Version)
+				return deleteErr
+			}
+			_, upErr := tx.Exec(ctx, step.Up)
+			if upErr != nil {
+				return upErr
+			}
+			_, insertErr := tx.Exec(ctx,
+				"INSERT INTO "+table+" (version, name, checksum) VALUES ($1, $2, $3)",
+				step.Version, step.Name, step.Checksum,
+			)
+			return insertErr
+		})
+		if stepErr != nil {
+			return taken, fmt.Errorf("Migration %v failed: %w", step, stepErr)
+		}
+		m.logger.Info("Migration applied", "step", step.String())
+		taken = append(taken, step)
+	}
+	return taken, nil
+}
+
+type appliedRecord struct {
+	checksum string
+	at       time.Time
+}
+
+// applied reads the records of the table. A missing table means nothing was
+// applied yet.
+func (m *Migrator) applied(ctx context.Context, conn *pgxpool.Conn) (map[int64]appliedRecord, error) {
+	records := map[int64]appliedRecord{}
+
+	var exists bool
+	existsErr := conn.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", pgx.Identifier{m.table}.Sanitize()).Scan(&exists)
+	if existsErr != nil || !exists {
+		return records, existsErr
+	}
+
+	rows, queryErr := conn.Query(ctx, "SELECT version, checksum, applied_at FROM "+pgx.Identifier{m.table}.Sanitize())
+	if queryErr != nil {
+		return nil, queryErr
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int64
+		var record appliedRecord
+		scanErr := rows.Scan(&version, &record.checksum, &record.at)
+		if scanErr != nil {
+			return nil, scanErr
+		}
+		records[version] = record
+	}
+	return records, rows.Err()
+}
+
+// plan verifies the applied migrations still match their files, and then lists
+// the steps reaching the target.
+func (m *Migrator) plan(applied map[int64]appliedRecord, target int64) ([]MigrationStep, error) {
+	known := map[int64]Migration{}
+	for _, migration := range m.migrations {
+		known[migration.Version] = migration
+	}
+	for version, record := range applied {
+		migration, found := known[version]
+		if !found {
+			return nil, fmt.Errorf("Migration %v is applied, but its file is missing.", version)
+		}
+		if migration.Checksum != record.checksum {
+			return nil, fmt.Errorf("Migration %v changed after it was applied.", version)
+		}
+	}
+
+	if target == MIGRATE_LATEST {
+		target = 0
+		if len(m.migrations) > 0 {
+			target = m.migrations[len(m.migrations)-1].Version
+		}
+	}
+	if _, found := known[target]; !found && target != 0 {
+		return nil, fmt.Errorf("No migration with version %v.", target)
+	}
+
+	steps := []MigrationStep{}
+	for _, migration := range m.migrations {
+		_, isApplied := applied[migration.Version]
+		if !isApplied && migration.Version <= target {
+			steps = append(steps, MigrationStep{Migration: migration})
+		}
+	}
+	for _, migration := range slices.Backward(m.migrations) {
+		_, isApplied := applied[migration.Version]
+		if isApplied && migration.Version > target {
+			if migration.Down == "" {
+				return nil, fmt.Errorf("Migration %v lacks a down file.", migration.Version)
+			}
+			steps = append(steps, MigrationStep{Migration: migration, Revert: true})
+		}
+	}
+	return steps, nil
+}
@@ -0,0 +1,98 @@
+package rdbms
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+)
+
+// MIGRATE_USAGE describes the arguments of MigrateCommand.
+const MIGRATE_USAGE = `usage:
+	migrate status
+	migrate up [-to VERSION] [-dry-run]
+	migrate down [-to VERSION] [-dry-run]`
+
+// MigrateCommand serves a CLI subcommand of an executable, e.g.,
+// os.Args[2:] of "app migrate up -to 3". Without -to, up applies every pending
+// migration, and down reverts the last applied one. Up refuses a target below
+// the current version, and down one above it. -dry-run prints the steps
+// without taking them.
+func MigrateCommand(ctx context.Context, m *Migrator, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(MIGRATE_USAGE)
+	}
+
+	if args[0] == "status" {
+		status, statusErr := m.Status(ctx)
+		if statusErr != nil {
+			return statusErr
+		}
+		for _, s := range status {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(out, "%06d_%v %v\n", s.Version, s.Name, state)
+		}
+		return nil
+	}
+
+	if args[0] != "up" && args[0] != "down" {
+		return errors.New(MIGRATE_USAGE)
+	}
+	flags := flag.NewFlagSet("migrate "+args[0], flag.ContinueOnError)
+	flags.SetOutput(out)
+	target := flags.Int64("to", MIGRATE_LATEST, "version to reach")
+	dryRun := flags.Bool("dry-run", false, "print the steps without taking them")
+	parseErr := flags.Parse(args[1:])
+	if parseErr != nil {
+		return parseErr
+	}
+
+	current, previous, versionErr := m.versions(ctx)
+	if versionErr != nil {
+		return versionErr
+	}
+	if args[0] == "down" && *target == MIGRATE_LATEST {
+		*target = previous
+	}
+	if args[0] == "up" && *target != MIGRATE_LATEST && *target < current {
+		return fmt.Errorf("Migrate up can't revert version %v to %v. Use migrate down.", current, *target)
+	}
+	if args[0] == "down" && *target > current {
+		return fmt.Errorf("Migrate down can't apply version %v above %v. Use migrate up.", *target, current)
+	}
+
+	var steps []MigrationStep
+	var err error
+	if *dryRun {
+		steps, err = m.Plan(ctx, *target)
+	} else {
+		steps, err = m.Migrate(ctx, *target)
+	}
+	for _, step := range steps {
+		fmt.Fprintln(out, step)
+	}
+	if len(steps) == 0 && err == nil {
+		fmt.Fprintln(out, "no change")
+	}
+	return err
+}
+
+// versions finds the last applied version, and the applied version before it.
+// Either is 0 when there is none.
+func (m *Migrator) versions(ctx context.Context) (int64, int64, error) {
+	status, statusErr := m.Status(ctx)
+	if statusErr != nil {
+		return 0, 0, statusErr
+	}
+	applied := []int64{0, 0}
+	for _, s := range status {
+		if s.Applied {
+			applied = append(applied, s.Version)
+		}
+	}
+	return applied[len(applied)-1], applied[len(applied)-2], nil
+}
@@ -0,0 +1,91 @@
+//go:build integration
+
+package rdbms_test
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Shoowa/vamos/config"
+	. "github.com/Shoowa/vamos/data/rdbms"
+	"github.com/Shoowa/vamos/secrets"
+	. "github.com/Shoowa/vamos/testhelper"
+)
+
+func Test_Migrate(t *testing.T) {
+	t.Setenv("APP_ENV", "DEV")
+	t.Setenv("OPENBAO_TOKEN", "token")
+	cfg, cfgErr := config.Read()
+	Ok(t, cfgErr)
+	sk := new(secrets.SkeletonKey)
+	sk.Create(cfg)
+	db, dbErr := ConnectDB(cfg, sk, cfg.Test.DbPosition)
+	Ok(t, dbErr)
+	t.Cleanup(func() { Close(db) })
+
+	fsys := fstest.MapFS{
+		"000001_gadgets.up.sql":   {Data: []byte("CREATE TABLE migrate_test_gadgets (id INT);")},
+		"000001_gadgets.down.sql": {Data: []byte("DROP TABLE migrate_test_gadgets;")},
+		"000002_widgets.up.sql":   {Data: []byte("CREATE TABLE migrate_test_widgets (id INT); INSERT INTO migrate_test_widgets VALUES (1);")},
+		"000002_widgets.down.sql": {Data: []byte("DROP TABLE migrate_test_widgets;")},
+	}
+	migrator, migratorErr := NewMigrator(db, fsys, WithMigrationsTable("migrate_test_versions"))
+	Ok(t, migratorErr)
+	ctx := context.Background()
+	t.Cleanup(func() {
+		migrator.Migrate(ctx, 0)
+		db.Exec(ctx, "DROP TABLE IF EXISTS migrate_test_versions")
+	})
+
+	// A dry run changes nothing.
+	plan, planErr := migrator.Plan(ctx, MIGRATE_LATEST)
+	Ok(t, planErr)
+	Equals(t, 2, len(plan))
+	status, statusErr := migrator.Status(ctx)
+	Ok(t, statusErr)
+	Assert(t, !status[0].Applied, "Expected nothing applied after a dry run.")
+
+	// Concurrent runs wait for the advisory lock, so each step is taken once.
+	var wg sync.WaitGroup
+	taken := make([]int, 3)
+	for i := range taken {
+		wg.Go(func() {
+			steps, err := migrator.Migrate(ctx, MIGRATE_LATEST)
+			Ok(t, err)
+			taken[i] = len(steps)
+		})
+	}
+	wg.Wait()
+	Equals(t, 2, taken[0]+taken[1]+taken[2])
+
+	// Up refuses a target below the current version, and reverts nothing.
+	var out bytes.Buffer
+	upErr := MigrateCommand(ctx, migrator, []string{"up", "-to", "1"}, &out)
+	Assert(t, upErr != nil, "Expected migrate up to refuse a lower version.")
+	status, statusErr = migrator.Status(ctx)
+	Ok(t, statusErr)
+	Assert(t, status[1].Applied, "Expected migrate up to revert nothing.")
+
+	// Revert to a target version.
+	steps, downErr := migrator.Migrate(ctx, 1)
+	Ok(t, downErr)
+	Equals(t, 1, len(steps))
+	Assert(t, steps[0].Revert, "Expected a reverted step.")
+
+	// Down refuses a target above the current version, and applies nothing.
+	downCmdErr := MigrateCommand(ctx, migrator, []string{"down", "-to", "2"}, &out)
+	Assert(t, downCmdErr != nil, "Expected migrate down to refuse a higher version.")
+	status, statusErr = migrator.Status(ctx)
+	Ok(t, statusErr)
+	Assert(t, !status[1].Applied, "Expected migrate down to apply nothing.")
+
+	// An edited file is refused.
+	fsys["000001_gadgets.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE migrate_test_gadgets (id BIGINT);")}
+	edited, editedErr := NewMigrator(db, fsys, WithMigrationsTable("migrate_test_versions"))
+	Ok(t, editedErr)
+	_, checksumErr := edited.Migrate(ctx, MIGRATE_LATEST)
+	Assert(t, checksumErr != nil, "Expected a changed checksum to fail.")
+}
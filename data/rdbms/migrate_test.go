@@ -0,0 +1,56 @@
+//go:build !integration
+
+package rdbms_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	. "github.com/Shoowa/vamos/data/rdbms"
+	. "github.com/Shoowa/vamos/testhelper"
+)
+
+func Test_LoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"000002_books.up.sql":            {Data: []byte("CREATE TABLE books ();")},
+		"000001_create_authors.up.sql":   {Data: []byte("CREATE TABLE authors ();")},
+		"000001_create_authors.down.sql": {Data: []byte("DROP TABLE authors;")},
+		"README.md":                      {Data: []byte("ignored")},
+	}
+	migrations, err := LoadMigrations(fsys)
+	Ok(t, err)
+	Equals(t, 2, len(migrations))
+	Equals(t, int64(1), migrations[0].Version)
+	Equals(t, "create_authors", migrations[0].Name)
+	Equals(t, "DROP TABLE authors;", migrations[0].Down)
+	Equals(t, "", migrations[1].Down)
+	Equals(t, 64, len(migrations[1].Checksum))
+
+	// The migrations of the example are readable.
+	example, exampleErr := LoadMigrations(os.DirFS("../../_example/sqlc/migrations/first"))
+	Ok(t, exampleErr)
+	Equals(t, "books", example[1].Name)
+
+	_, missingErr := LoadMigrations(fstest.MapFS{"000003_x.down.sql": {Data: []byte("")}})
+	Assert(t, missingErr != nil, "Expected a missing up file to fail.")
+
+	_, namesErr := LoadMigrations(fstest.MapFS{
+		"000004_a.up.sql":   {Data: []byte("")},
+		"000004_b.down.sql": {Data: []byte("")},
+	})
+	Assert(t, namesErr != nil, "Expected two names of a version to fail.")
+}
+
+func Test_MigrateCommand_Usage(t *testing.T) {
+	migrator, err := NewMigrator(nil, fstest.MapFS{})
+	Ok(t, err)
+
+	var out bytes.Buffer
+	Equals(t, MIGRATE_USAGE, MigrateCommand(context.Background(), migrator, nil, &out).Error())
+	Equals(t, MIGRATE_USAGE, MigrateCommand(context.Background(), migrator, []string{"sideways"}, &out).Error())
+	flagErr := MigrateCommand(context.Background(), migrator, []string{"up", "-to", "three"}, &out)
+	Assert(t, flagErr != nil, "Expected an unreadable version to fail.")
+}
@@ -2,7 +2,10 @@ package rdbms
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -17,9 +20,12 @@ const (
 )
 
 // WhichDB reads from a list of databases in the Config struct. A developer must
-// select an index in that array.
-func WhichDB(cfg *config.Config, dbPosition int) config.Rdb {
-	return cfg.Data.Relational[dbPosition]
+// select an index in that array. A Registry finds databases by name instead.
+func WhichDB(cfg *config.Config, dbPosition int) (config.Rdb, error) {
+	if cfg.Data == nil || dbPosition < 0 || dbPosition >= len(cfg.Data.Relational) {
+		return config.Rdb{}, fmt.Errorf("No database at position %v.", dbPosition)
+	}
+	return cfg.Data.Relational[dbPosition], nil
 }
 
 func sslMode(flag bool) string {
@@ -30,19 +36,90 @@ func sslMode(flag bool) string {
 	}
 }
 
-// Credentials conveniently assembles a string for the Postgres client.
+// Credentials conveniently assembles a string for the Postgres client. Blank
+// values are left out, e.g., the user of a database leasing dynamic
+// credentials, and the others are quoted.
 func Credentials(db config.Rdb) (string, error) {
-	credString := fmt.Sprintf(
-		"user=%v host=%v database=%v sslmode=%v",
-		db.User, db.Host, db.Database, sslMode(db.Sslmode),
-	)
-	return credString, nil
+	params := []struct{ key, value string }{
+		{"user", db.User},
+		{"host", db.Host},
+		{"database", db.Database},
+		{"sslmode", sslMode(db.Sslmode)},
+		{"port", db.Port},
+	}
+
+	parts := []string{}
+	for _, p := range params {
+		if p.value != "" {
+			parts = append(parts, p.key+"='"+dsnEscape.Replace(p.value)+"'")
+		}
+	}
+	return strings.Join(parts, " "), nil
 }
 
-// configure chooses a database from an array in the Config file, and then adds
-// the capability to read a password from secret storage any time, and adds TLS.
-func configure(cfg *config.Config, dbPosition int) (*pgxpool.Config, error) {
-	db := WhichDB(cfg, dbPosition)
+// dsnEscape escapes the backslashes & quotes inside a quoted value of a
+// connection string.
+var dsnEscape = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// execModes translates Rdb.QueryExecMode.
+var execModes = map[string]pgx.QueryExecMode{
+	"cache_statement": pgx.QueryExecModeCacheStatement,
+	"cache_describe":  pgx.QueryExecModeCacheDescribe,
+	"describe_exec":   pgx.QueryExecModeDescribeExec,
+	"exec":            pgx.QueryExecModeExec,
+	"simple_protocol": pgx.QueryExecModeSimpleProtocol,
+}
+
+// tune applies the pool settings of a database. Zero values keep the defaults
+// of pgxpool & Postgres.
+func tune(pgxConfig *pgxpool.Config, db config.Rdb) error {
+	if db.PoolMaxConns > 0 {
+		pgxConfig.MaxConns = int32(db.PoolMaxConns)
+	}
+	if db.PoolMinConns > 0 {
+		pgxConfig.MinConns = int32(db.PoolMinConns)
+	}
+	if db.MaxConnLifetime > 0 {
+		pgxConfig.MaxConnLifetime = time.Second * time.Duration(db.MaxConnLifetime)
+	}
+	if db.MaxConnIdleTime > 0 {
+		pgxConfig.MaxConnIdleTime = time.Second * time.Duration(db.MaxConnIdleTime)
+	}
+	if db.HealthCheckPeriod > 0 {
+		pgxConfig.HealthCheckPeriod = time.Second * time.Duration(db.HealthCheckPeriod)
+	}
+
+	params := pgxConfig.ConnConfig.RuntimeParams
+	if db.ApplicationName != "" {
+		params["application_name"] = db.ApplicationName
+	}
+	if db.StatementTimeout > 0 {
+		params["statement_timeout"] = strconv.Itoa(db.StatementTimeout)
+	}
+	if db.SearchPath != "" {
+		params["search_path"] = db.SearchPath
+	}
+
+	if db.QueryExecMode != "" {
+		mode, found := execModes[db.QueryExecMode]
+		if !found {
+			return fmt.Errorf("Unknown query exec mode %q.", db.QueryExecMode)
+		}
+		pgxConfig.ConnConfig.DefaultQueryExecMode = mode
+	}
+	return nil
+}
+
+// PoolConfig chooses a database from an array in the Config file, and then adds
+// the capability to read a password from secret storage any time, adds TLS,
+// and applies the pool settings of the database. A shared SkeletonKey caches
+// the password, so a pool opening many connections at once only reads it from
+// Openbao once. ConnectDB uses it, and it can be inspected without connecting.
+func PoolConfig(cfg *config.Config, p secrets.Provider, dbPosition int) (*pgxpool.Config, error) {
+	db, dbErr := WhichDB(cfg, dbPosition)
+	if dbErr != nil {
+		return nil, dbErr
+	}
 
 	credString, credErr := Credentials(db)
 	if credErr != nil {
@@ -54,10 +131,13 @@ func configure(cfg *config.Config, dbPosition int) (*pgxpool.Config, error) {
 		return nil, configErr
 	}
 
+	tuneErr := tune(pgxConfig, db)
+	if tuneErr != nil {
+		return nil, tuneErr
+	}
+
 	pgxConfig.BeforeConnect = func(ctx context.Context, cc *pgx.ConnConfig) error {
-		secretsReader := new(secrets.SkeletonKey)
-		secretsReader.Create(cfg)
-		pw, pwErr := secretsReader.ReadPathAndKey(db.Secret, db.SecretKey)
+		pw, pwErr := p.ReadKey(ctx, db.SecretMount, db.Secret, db.SecretKey)
 		if pwErr != nil {
 			return pwErr
 		}
@@ -67,14 +147,10 @@ func configure(cfg *config.Config, dbPosition int) (*pgxpool.Config, error) {
 	}
 
 	if db.Sslmode == true {
-		// temporary SecretsReader creation that will die out of scope.
-		secReader := new(secrets.SkeletonKey)
-		secReader.Create(cfg)
-
 		// Read certificate, key, CA from Secrets storage.
-		tlsInfo, tlsErr := secReader.ConfigureTLSwithCA(cfg.HttpServer)
+		tlsInfo, tlsErr := secrets.ClientTLS(p, cfg.HttpServer)
 		if tlsErr != nil {
-			panic(tlsErr.Error())
+			return nil, tlsErr
 		}
 
 		// Add expected hostname of Postgres server.
@@ -87,26 +163,62 @@ func configure(cfg *config.Config, dbPosition int) (*pgxpool.Config, error) {
 	return pgxConfig, nil
 }
 
-// ConnectDB configures and creates a Postgres connection pool.
-func ConnectDB(cfg *config.Config, dbPosition int) (*pgxpool.Pool, error) {
-	dbConfig, dbConfigErr := configure(cfg, dbPosition)
+// ConnectDB configures and creates a Postgres connection pool. The Provider
+// reads the password & TLS material. When the database declares a CredsRole,
+// the user & password are leased from the Openbao database secrets engine
+// instead, and replaced before the lease expires. Leasing needs the SkeletonKey
+// as the Provider. Otherwise, a Provider that is a secrets.Notifier resets the
+// pool whenever the password changes. Release a pool with Close, so the lease
+// is revoked and the watch ends.
+func ConnectDB(cfg *config.Config, p secrets.Provider, dbPosition int) (*pgxpool.Pool, error) {
+	dbConfig, dbConfigErr := PoolConfig(cfg, p, dbPosition)
 	if dbConfigErr != nil {
 		return nil, dbConfigErr
 	}
 
+	// PoolConfig found the database already.
+	db, _ := WhichDB(cfg, dbPosition)
+	var creds *dynamicCreds
+	if db.CredsRole != "" {
+		sk, isOpenbao := p.(*secrets.SkeletonKey)
+		if !isOpenbao {
+			return nil, errors.New("Dynamic credentials need the Openbao provider.")
+		}
+		var credsErr error
+		creds, credsErr = leaseCreds(sk, db)
+		if credsErr != nil {
+			return nil, credsErr
+		}
+		dbConfig.BeforeConnect = creds.beforeConnect
+	}
+
 	ctxTimer, cancel := context.WithTimeout(context.Background(), TIMEOUT_PING)
 	defer cancel()
 
 	dbpool, connErr := pgxpool.NewWithConfig(ctxTimer, dbConfig)
 
 	if connErr != nil {
+		if creds != nil {
+			creds.revoke(creds.current())
+		}
 		return nil, connErr
 	}
 
 	pingErr := dbpool.Ping(ctxTimer)
 	if pingErr != nil {
+		dbpool.Close()
+		if creds != nil {
+			creds.revoke(creds.current())
+		}
 		return nil, pingErr
 	}
 
+	if creds != nil {
+		creds.start(dbpool)
+		leases.Store(dbpool, creds)
+	} else if n, isNotifier := p.(secrets.Notifier); isNotifier {
+		watchPassword(n, db, dbpool)
+	}
+
 	return dbpool, nil
 }
@@ -3,11 +3,15 @@
 package rdbms_test
 
 import (
+	"context"
 	"os"
 	"testing"
 
+	"github.com/jackc/pgx/v5"
+
 	"github.com/Shoowa/vamos/config"
 	. "github.com/Shoowa/vamos/data/rdbms"
+	"github.com/Shoowa/vamos/secrets"
 	. "github.com/Shoowa/vamos/testhelper"
 )
 
@@ -24,8 +28,31 @@ func TestMain(m *testing.M) {
 func Test_ConnectDB(t *testing.T) {
 	t.Setenv("APP_ENV", "DEV")
 	t.Setenv("OPENBAO_TOKEN", "token")
-	cfg := config.Read()
-	db, dbErr := ConnectDB(cfg, cfg.Test.DbPosition)
+	cfg, cfgErr := config.Read()
+	Ok(t, cfgErr)
+	sk := new(secrets.SkeletonKey)
+	sk.Create(cfg)
+	db, dbErr := ConnectDB(cfg, sk, cfg.Test.DbPosition)
 	Ok(t, dbErr)
-	t.Cleanup(func() { db.Close() })
+	t.Cleanup(func() { Close(db) })
+}
+
+func Test_WithTx(t *testing.T) {
+	t.Setenv("APP_ENV", "DEV")
+	t.Setenv("OPENBAO_TOKEN", "token")
+	cfg, cfgErr := config.Read()
+	Ok(t, cfgErr)
+	sk := new(secrets.SkeletonKey)
+	sk.Create(cfg)
+	db, dbErr := ConnectDB(cfg, sk, cfg.Test.DbPosition)
+	Ok(t, dbErr)
+	t.Cleanup(func() { Close(db) })
+
+	opts := TxOptions{TxOptions: pgx.TxOptions{IsoLevel: pgx.Serializable, AccessMode: pgx.ReadOnly}}
+	var readOnly string
+	txErr := WithTx(context.Background(), db, opts, func(tx pgx.Tx) error {
+		return tx.QueryRow(context.Background(), "SHOW transaction_read_only").Scan(&readOnly)
+	})
+	Ok(t, txErr)
+	Equals(t, "on", readOnly)
 }
@@ -0,0 +1,85 @@
+//go:build !integration
+
+package rdbms_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Shoowa/vamos/config"
+	. "github.com/Shoowa/vamos/data/rdbms"
+	"github.com/Shoowa/vamos/secrets"
+	. "github.com/Shoowa/vamos/testhelper"
+)
+
+func Test_PoolConfig(t *testing.T) {
+	db := config.Rdb{
+		Host:              "db.internal",
+		Port:              "6432",
+		User:              "app",
+		Database:          "orders",
+		Secret:            "orders",
+		SecretKey:         "password",
+		PoolMaxConns:      20,
+		PoolMinConns:      2,
+		MaxConnLifetime:   3600,
+		MaxConnIdleTime:   300,
+		HealthCheckPeriod: 15,
+		ApplicationName:   "orders-api",
+		StatementTimeout:  2500,
+		SearchPath:        "orders,public",
+		QueryExecMode:     "exec",
+	}
+	cfg := &config.Config{Data: &config.Data{Relational: []config.Rdb{{Host: "other", Database: "other"}, db}}}
+
+	// Parsing the config doesn't connect, so no secrets are needed.
+	pool, poolErr := PoolConfig(cfg, secrets.NewMemoryProvider(), 1)
+	Ok(t, poolErr)
+
+	Equals(t, uint16(6432), pool.ConnConfig.Port)
+	Equals(t, int32(20), pool.MaxConns)
+	Equals(t, int32(2), pool.MinConns)
+	Equals(t, time.Hour, pool.MaxConnLifetime)
+	Equals(t, time.Minute*5, pool.MaxConnIdleTime)
+	Equals(t, time.Second*15, pool.HealthCheckPeriod)
+	Equals(t, "orders-api", pool.ConnConfig.RuntimeParams["application_name"])
+	Equals(t, "2500", pool.ConnConfig.RuntimeParams["statement_timeout"])
+	Equals(t, "orders,public", pool.ConnConfig.RuntimeParams["search_path"])
+	Equals(t, pgx.QueryExecModeExec, pool.ConnConfig.DefaultQueryExecMode)
+
+	// Zero values keep the defaults.
+	plain, plainErr := PoolConfig(cfg, secrets.NewMemoryProvider(), 0)
+	Ok(t, plainErr)
+	Equals(t, uint16(5432), plain.ConnConfig.Port)
+	Equals(t, pgx.QueryExecModeCacheStatement, plain.ConnConfig.DefaultQueryExecMode)
+
+	// A missing position is an error, not a panic.
+	_, missingErr := PoolConfig(cfg, secrets.NewMemoryProvider(), 2)
+	Assert(t, missingErr != nil, "Expected an error for a missing database.")
+	_, whichErr := WhichDB(&config.Config{}, 0)
+	Assert(t, whichErr != nil, "Expected an error without databases.")
+}
+
+func Test_Credentials(t *testing.T) {
+	// A database leasing dynamic credentials has no user until BeforeConnect.
+	leased := config.Rdb{Host: "db.internal", Port: "5433", Database: "app", CredsRole: "app"}
+	credString, credErr := Credentials(leased)
+	Ok(t, credErr)
+	parsed, parseErr := pgxpool.ParseConfig(credString)
+	Ok(t, parseErr)
+	Equals(t, "db.internal", parsed.ConnConfig.Host)
+	Equals(t, uint16(5433), parsed.ConnConfig.Port)
+	Equals(t, "app", parsed.ConnConfig.Database)
+
+	// Quotes & backslashes inside a value are escaped.
+	odd := config.Rdb{User: `o'brien\x`, Host: "db.internal", Database: "my app"}
+	credString, credErr = Credentials(odd)
+	Ok(t, credErr)
+	parsed, parseErr = pgxpool.ParseConfig(credString)
+	Ok(t, parseErr)
+	Equals(t, `o'brien\x`, parsed.ConnConfig.User)
+	Equals(t, "my app", parsed.ConnConfig.Database)
+}
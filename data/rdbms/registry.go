@@ -0,0 +1,175 @@
+package rdbms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/Shoowa/vamos/config"
+	"github.com/Shoowa/vamos/metrics"
+	"github.com/Shoowa/vamos/secrets"
+)
+
+// ErrUnknownDB means no database in Data.Relational has the name.
+var ErrUnknownDB = errors.New("Unknown database.")
+
+// Registry holds a pool for every database in Data.Relational, found by name.
+type Registry struct {
+	names []string
+	pools map[string]*pgxpool.Pool
+	errs  map[string]error
+}
+
+// OpenRegistry opens every configured database concurrently. The pools that
+// open are kept, even when others fail. The failures are joined in the error,
+// and reported again by Get & Ping, so a health check notices them.
+func OpenRegistry(cfg *config.Config, p secrets.Provider) (*Registry, error) {
+	dbs := cfg.Data.Relational
+	pools := make([]*pgxpool.Pool, len(dbs))
+	errs := make([]error, len(dbs))
+
+	var wg sync.WaitGroup
+	for i := range dbs {
+		wg.Go(func() { pools[i], errs[i] = ConnectDB(cfg, p, i) })
+	}
+	wg.Wait()
+
+	r := &Registry{
+		names: make([]string, len(dbs)),
+		pools: map[string]*pgxpool.Pool{},
+		errs:  map[string]error{},
+	}
+	failed := []error{}
+	for i, db := range dbs {
+		r.names[i] = db.Name
+		if errs[i] != nil {
+			r.errs[db.Name] = errs[i]
+			failed = append(failed, fmt.Errorf("Database %v failed to open: %w", db.Name, errs[i]))
+			continue
+		}
+		r.pools[db.Name] = pools[i]
+		observed.Store(db.Name, pools[i])
+	}
+
+	return r, errors.Join(failed...)
+}
+
+// Names lists the configured databases in the order of Data.Relational.
+func (r *Registry) Names() []string {
+	return append([]string{}, r.names...)
+}
+
+// Get returns the pool of a database, or the error that prevented it from
+// opening.
+func (r *Registry) Get(name string) (*pgxpool.Pool, error) {
+	if pool, found := r.pools[name]; found {
+		return pool, nil
+	}
+	if err, found := r.errs[name]; found {
+		return nil, err
+	}
+	return nil, fmt.Errorf("Database %q isn't configured: %w", name, ErrUnknownDB)
+}
+
+// Default returns the pool of the first configured database, or nil when it
+// failed to open.
+func (r *Registry) Default() *pgxpool.Pool {
+	if len(r.names) == 0 {
+		return nil
+	}
+	return r.pools[r.names[0]]
+}
+
+// Ping pings every pool concurrently, and returns the error of each database
+// that failed, including the ones that never opened.
+func (r *Registry) Ping(ctx context.Context) map[string]error {
+	var mu sync.Mutex
+	failed := map[string]error{}
+	for name, err := range r.errs {
+		failed[name] = err
+	}
+
+	var wg sync.WaitGroup
+	for name, pool := range r.pools {
+		wg.Go(func() {
+			err := pool.Ping(ctx)
+			if err != nil {
+				mu.Lock()
+				failed[name] = err
+				mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+	return failed
+}
+
+// Close closes every pool with Close, so leases are revoked.
+func (r *Registry) Close() error {
+	errs := []error{}
+	for name, pool := range r.pools {
+		observed.CompareAndDelete(name, pool)
+		err := Close(pool)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Database %v failed to close: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// observed holds the open pools of every Registry by name, so their statistics
+// are exposed on the /metrics endpoint.
+var observed sync.Map
+
+var (
+	poolConnsDesc = prometheus.NewDesc(
+		"vamos_rdbms_pool_connections",
+		"Connections of each Postgres pool by state.",
+		[]string{"database", "state"}, nil,
+	)
+	poolAcquiresDesc = prometheus.NewDesc(
+		"vamos_rdbms_pool_acquires_total",
+		"Connections acquired from each Postgres pool.",
+		[]string{"database"}, nil,
+	)
+	poolWaitDesc = prometheus.NewDesc(
+		"vamos_rdbms_pool_acquire_wait_seconds_total",
+		"Time spent waiting for a connection from each Postgres pool.",
+		[]string{"database"}, nil,
+	)
+)
+
+// poolCollector reads the statistics of every observed pool on each scrape.
+type poolCollector struct{}
+
+func (poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolConnsDesc
+	ch <- poolAcquiresDesc
+	ch <- poolWaitDesc
+}
+
+func (poolCollector) Collect(ch chan<- prometheus.Metric) {
+	observed.Range(func(key, value any) bool {
+		name := key.(string)
+		stat := value.(*pgxpool.Pool).Stat()
+
+		conns := map[string]int32{
+			"idle":     stat.IdleConns(),
+			"acquired": stat.AcquiredConns(),
+			"total":    stat.TotalConns(),
+			"max":      stat.MaxConns(),
+		}
+		for state, amount := range conns {
+			ch <- prometheus.MustNewConstMetric(poolConnsDesc, prometheus.GaugeValue, float64(amount), name, state)
+		}
+		ch <- prometheus.MustNewConstMetric(poolAcquiresDesc, prometheus.CounterValue, float64(stat.AcquireCount()), name)
+		ch <- prometheus.MustNewConstMetric(poolWaitDesc, prometheus.CounterValue, stat.AcquireDuration().Seconds(), name)
+		return true
+	})
+}
+
+var poolStats = metrics.RegisterCollector(poolCollector{})
@@ -0,0 +1,37 @@
+//go:build !integration
+
+package rdbms_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Shoowa/vamos/config"
+	. "github.com/Shoowa/vamos/data/rdbms"
+	"github.com/Shoowa/vamos/secrets"
+	. "github.com/Shoowa/vamos/testhelper"
+)
+
+func Test_Registry_Unreachable(t *testing.T) {
+	unreachable := func(name string) config.Rdb {
+		return config.Rdb{Name: name, Host: "127.0.0.1", Port: "1", User: "app", Database: name}
+	}
+	cfg := &config.Config{Data: &config.Data{Relational: []config.Rdb{unreachable("orders"), unreachable("billing")}}}
+
+	registry, err := OpenRegistry(cfg, secrets.NewMemoryProvider())
+	Assert(t, err != nil, "Expected unreachable databases to fail.")
+	defer registry.Close()
+
+	Equals(t, []string{"orders", "billing"}, registry.Names())
+	Assert(t, registry.Default() == nil, "Expected no default pool.")
+
+	_, getErr := registry.Get("orders")
+	Assert(t, getErr != nil && !errors.Is(getErr, ErrUnknownDB), "Expected the open error, got %v", getErr)
+
+	_, unknownErr := registry.Get("missing")
+	Assert(t, errors.Is(unknownErr, ErrUnknownDB), "Expected ErrUnknownDB, got %v", unknownErr)
+
+	failed := registry.Ping(context.Background())
+	Equals(t, 2, len(failed))
+}
@@ -0,0 +1,36 @@
+package rdbms
+
+import (
+	"log/slog"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Shoowa/vamos/config"
+	"github.com/Shoowa/vamos/secrets"
+)
+
+// watches associates a pool with its subscription to changes of the password,
+// so that Close can end it.
+var watches sync.Map
+
+// watchPassword resets the pool whenever the secret holding the password
+// changes, e.g., after an operator rotates it. Idle connections close at once,
+// and busy connections close once released. New connections read the new
+// password in BeforeConnect.
+func watchPassword(n secrets.Notifier, db config.Rdb, pool *pgxpool.Pool) {
+	logger := slog.Default().With("database", db.Database, "secret", db.Secret)
+	stop := n.OnChange(db.SecretMount, db.Secret, func(change secrets.SecretChange) {
+		pool.Reset()
+		logger.Info("Postgres connections reset after the password changed", "version", change.Version)
+	})
+	watches.Store(pool, stop)
+}
+
+// unwatchPassword ends the subscription of a pool, if any.
+func unwatchPassword(pool *pgxpool.Pool) {
+	stop, found := watches.LoadAndDelete(pool)
+	if found {
+		stop.(func())()
+	}
+}
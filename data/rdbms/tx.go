@@ -0,0 +1,186 @@
+package rdbms
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/Shoowa/vamos/metrics"
+)
+
+const (
+	// TX_MAX_ATTEMPTS is the amount of times a transaction runs before a
+	// serialization failure or deadlock is returned.
+	TX_MAX_ATTEMPTS = 3
+	// TX_BACKOFF_BASE is the wait before the first retry. It doubles with each
+	// retry, and half of it is random.
+	TX_BACKOFF_BASE = time.Millisecond * 10
+	// TX_BACKOFF_MAX bounds the wait between retries.
+	TX_BACKOFF_MAX = time.Second
+)
+
+// retryCodes are the SQLSTATEs of a transaction that may succeed when run
+// again: serialization_failure & deadlock_detected.
+var retryCodes = map[string]bool{
+	"40001": true,
+	"40P01": true,
+}
+
+var (
+	txAttempts = metrics.CreateCounterVec(
+		"vamos", "rdbms", "tx_attempts_total",
+		"Amount of transaction attempts, by name.",
+		[]string{"name"},
+	)
+	txRetries = metrics.CreateCounterVec(
+		"vamos", "rdbms", "tx_retries_total",
+		"Amount of transactions run again, by name & SQLSTATE.",
+		[]string{"name", "sqlstate"},
+	)
+	txDuration = metrics.CreateHistogramVec(
+		"vamos", "rdbms", "tx_duration_seconds",
+		"Duration of transactions including retries, by name & result.",
+		prometheus.DefBuckets,
+		[]string{"name", "result"},
+	)
+)
+
+// TxBeginner starts a transaction. A *pgxpool.Pool, a *pgx.Conn, a Cluster,
+// and a pgx.Tx fulfill it.
+type TxBeginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// txOptionsBeginner starts a transaction with an isolation level, access mode,
+// and deferrable mode.
+type txOptionsBeginner interface {
+	BeginTx(ctx context.Context, opts pgx.TxOptions) (pgx.Tx, error)
+}
+
+// TxOptions configures WithTx. The embedded pgx.TxOptions chooses the
+// isolation level, e.g., pgx.Serializable, READ ONLY, and DEFERRABLE.
+type TxOptions struct {
+	pgx.TxOptions
+	// Name labels the metrics of the transaction. Defaults to unnamed.
+	Name string
+	// MaxAttempts replaces TX_MAX_ATTEMPTS.
+	MaxAttempts int
+}
+
+// WithTx runs fn in a transaction, commits when fn returns nil, and rolls back
+// otherwise. A serialization failure or deadlock runs fn again in a new
+// transaction after a jittered backoff, so fn must be safe to repeat.
+//
+// When db is a pgx.Tx, fn runs in a savepoint instead, and isn't retried. A
+// failure of the savepoint is returned to the outer transaction, which retries
+// as a whole.
+func WithTx(ctx context.Context, db TxBeginner, opts TxOptions, fn func(pgx.Tx) error) error {
+	if outer, isTx := db.(pgx.Tx); isTx {
+		savepoint, spErr := outer.Begin(ctx)
+		if spErr != nil {
+			return spErr
+		}
+		return runTx(ctx, savepoint, fn)
+	}
+
+	name := opts.Name
+	if name == "" {
+		name = "unnamed"
+	}
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = TX_MAX_ATTEMPTS
+	}
+
+	start := time.Now()
+	var err error
+	for attempt := 1; ; attempt++ {
+		txAttempts.WithLabelValues(name).Inc()
+		err = attemptTx(ctx, db, opts.TxOptions, fn)
+
+		code, retry := retryable(err)
+		if !retry || attempt >= maxAttempts {
+			break
+		}
+		txRetries.WithLabelValues(name, code).Inc()
+
+		waitErr := backoff(ctx, attempt)
+		if waitErr != nil {
+			err = errors.Join(err, waitErr)
+			break
+		}
+	}
+
+	result := "commit"
+	if err != nil {
+		result = "error"
+	}
+	txDuration.WithLabelValues(name, result).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// attemptTx begins a transaction with the options, when db accepts them.
+func attemptTx(ctx context.Context, db TxBeginner, opts pgx.TxOptions, fn func(pgx.Tx) error) error {
+	var tx pgx.Tx
+	var beginErr error
+	if b, acceptsOptions := db.(txOptionsBeginner); acceptsOptions {
+		tx, beginErr = b.BeginTx(ctx, opts)
+	} else if opts != (pgx.TxOptions{}) {
+		return errors.New("Transaction options need a BeginTx method.")
+	} else {
+		tx, beginErr = db.Begin(ctx)
+	}
+	if beginErr != nil {
+		return beginErr
+	}
+	return runTx(ctx, tx, fn)
+}
+
+// runTx commits or rolls back. A panic in fn rolls back, and then continues.
+func runTx(ctx context.Context, tx pgx.Tx, fn func(pgx.Tx) error) error {
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback(ctx)
+			panic(p)
+		}
+	}()
+
+	fnErr := fn(tx)
+	if fnErr != nil {
+		rollbackErr := tx.Rollback(ctx)
+		if rollbackErr != nil && !errors.Is(rollbackErr, pgx.ErrTxClosed) {
+			return errors.Join(fnErr, rollbackErr)
+		}
+		return fnErr
+	}
+	return tx.Commit(ctx)
+}
+
+// retryable reports the SQLSTATE of an error worth retrying.
+func retryable(err error) (string, bool) {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && retryCodes[pgErr.Code] {
+		return pgErr.Code, true
+	}
+	return "", false
+}
+
+// backoff waits before a retry, unless the context ends first.
+func backoff(ctx context.Context, attempt int) error {
+	wait := min(TX_BACKOFF_BASE<<(attempt-1), TX_BACKOFF_MAX)
+	wait = wait/2 + rand.N(wait/2+1)
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
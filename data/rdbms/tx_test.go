@@ -0,0 +1,129 @@
+//go:build !integration
+
+package rdbms_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	. "github.com/Shoowa/vamos/data/rdbms"
+	. "github.com/Shoowa/vamos/testhelper"
+)
+
+// fakeTx records how a transaction ended. Unused methods of pgx.Tx panic.
+type fakeTx struct {
+	pgx.Tx
+	db    *fakeDB
+	depth int
+}
+
+func (f *fakeTx) Begin(ctx context.Context) (pgx.Tx, error) {
+	f.db.savepoints++
+	return &fakeTx{db: f.db, depth: f.depth + 1}, nil
+}
+
+func (f *fakeTx) Commit(ctx context.Context) error {
+	f.db.commits++
+	return f.db.commitErr
+}
+
+func (f *fakeTx) Rollback(ctx context.Context) error {
+	f.db.rollbacks++
+	return nil
+}
+
+// fakeDB begins fakeTx, and records the options.
+type fakeDB struct {
+	opts       pgx.TxOptions
+	commitErr  error
+	savepoints int
+	commits    int
+	rollbacks  int
+}
+
+func (f *fakeDB) Begin(ctx context.Context) (pgx.Tx, error) {
+	return f.BeginTx(ctx, pgx.TxOptions{})
+}
+
+func (f *fakeDB) BeginTx(ctx context.Context, opts pgx.TxOptions) (pgx.Tx, error) {
+	f.opts = opts
+	return &fakeTx{db: f}, nil
+}
+
+func Test_WithTx_Retries(t *testing.T) {
+	db := &fakeDB{}
+	serialization := &pgconn.PgError{Code: "40001"}
+	opts := TxOptions{TxOptions: pgx.TxOptions{IsoLevel: pgx.Serializable}, Name: "transfer"}
+
+	runs := 0
+	err := WithTx(context.Background(), db, opts, func(tx pgx.Tx) error {
+		runs++
+		if runs < 3 {
+			return serialization
+		}
+		return nil
+	})
+	Ok(t, err)
+	Equals(t, 3, runs)
+	Equals(t, 2, db.rollbacks)
+	Equals(t, 1, db.commits)
+	Equals(t, pgx.Serializable, db.opts.IsoLevel)
+
+	// The last failure is returned once the attempts are exhausted.
+	runs = 0
+	err = WithTx(context.Background(), db, opts, func(tx pgx.Tx) error {
+		runs++
+		return &pgconn.PgError{Code: "40P01"}
+	})
+	Assert(t, err != nil, "Expected the deadlock to be returned.")
+	Equals(t, TX_MAX_ATTEMPTS, runs)
+
+	// Other errors aren't retried.
+	runs = 0
+	broken := errors.New("broken")
+	err = WithTx(context.Background(), db, TxOptions{}, func(tx pgx.Tx) error {
+		runs++
+		return broken
+	})
+	Assert(t, errors.Is(err, broken), "Expected the error of fn, got %v", err)
+	Equals(t, 1, runs)
+
+	// A serialization failure during commit is retried too.
+	db = &fakeDB{commitErr: serialization}
+	err = WithTx(context.Background(), db, TxOptions{MaxAttempts: 2}, func(tx pgx.Tx) error { return nil })
+	Assert(t, errors.As(err, &serialization), "Expected the serialization failure, got %v", err)
+	Equals(t, 2, db.commits)
+}
+
+func Test_WithTx_Savepoints(t *testing.T) {
+	db := &fakeDB{}
+
+	inner := errors.New("inner")
+	err := WithTx(context.Background(), db, TxOptions{}, func(tx pgx.Tx) error {
+		nestedErr := WithTx(context.Background(), tx, TxOptions{}, func(sp pgx.Tx) error {
+			Equals(t, 1, sp.(*fakeTx).depth)
+			return inner
+		})
+		Assert(t, errors.Is(nestedErr, inner), "Expected the savepoint error.")
+		return nil
+	})
+	Ok(t, err)
+	Equals(t, 1, db.savepoints)
+	// The savepoint rolled back, and the outer transaction committed.
+	Equals(t, 1, db.rollbacks)
+	Equals(t, 1, db.commits)
+}
+
+func Test_WithTx_Panic(t *testing.T) {
+	db := &fakeDB{}
+	defer func() {
+		Equals(t, "boom", recover())
+		Equals(t, 1, db.rollbacks)
+		Equals(t, 0, db.commits)
+	}()
+	WithTx(context.Background(), db, TxOptions{}, func(tx pgx.Tx) error { panic("boom") })
+}
@@ -8,16 +8,25 @@ import (
 	"github.com/Shoowa/vamos/config"
 )
 
+// logLevel is shared by every logger created in this package, so that it can
+// be adjusted while the application runs.
+var logLevel = new(slog.LevelVar)
+
 func configure(cfg *config.Config) *slog.HandlerOptions {
-	logLevel := &slog.LevelVar{}
+	SetLevel(cfg)
+	opts := &slog.HandlerOptions{Level: logLevel}
+	return opts
+}
+
+// SetLevel applies the configured level to every logger created by
+// CreateLogger. It can be subscribed to a config.Watcher to adjust logging
+// without a restart.
+func SetLevel(cfg *config.Config) {
 	if cfg.Logger.Debug == true {
 		logLevel.Set(slog.LevelDebug)
 	} else {
 		logLevel.Set(slog.LevelWarn)
 	}
-
-	opts := &slog.HandlerOptions{Level: logLevel}
-	return opts
 }
 
 // CreateLogger provides a structured JSON logger configured with a few fields
@@ -58,9 +58,14 @@ func addRuntimeMetrics(toggles *config.Metrics) prometheus.Collector {
 // createLoadedRegistry reads the config file directly, breaking the convention
 // of accepting a config struct from the main function. I chose to do this,
 // because the custom registry is a package variable. And it is much easier to
-// add metrics to a package variable.
+// add metrics to a package variable. When the config file can't be read, then
+// every optional runtime metric is disabled.
 func createLoadedRegistry() *prometheus.Registry {
-	toggles := config.Read().Metrics
+	toggles := new(config.Metrics)
+	cfg, cfgErr := config.Read()
+	if cfgErr == nil {
+		toggles = cfg.Metrics
+	}
 	runtimeCollector := addRuntimeMetrics(toggles)
 
 	reg := prometheus.NewRegistry()
@@ -124,6 +129,27 @@ func CreateCounter(name string, help string) prometheus.Counter {
 	return counter
 }
 
+// RegisterCollector registers a custom collector, e.g., one reading the
+// statistics of a pool when the metrics are scraped.
+func RegisterCollector(c prometheus.Collector) prometheus.Collector {
+	registry.MustRegister(c)
+	return c
+}
+
+// CreateCounterVec registers a custom counter partitioned by labels.
+func CreateCounterVec(ns, ss, name, help string, labels []string) *prometheus.CounterVec {
+	opts := prometheus.CounterOpts{
+		Namespace: ns,
+		Subsystem: ss,
+		Name:      name,
+		Help:      help,
+	}
+
+	counter := prometheus.NewCounterVec(opts, labels)
+	registry.MustRegister(counter)
+	return counter
+}
+
 // CreateGauge registers a custom gauge.
 func CreateGauge(ns, ss, name, help string) prometheus.Gauge {
 	opts := prometheus.GaugeOpts{
@@ -153,6 +179,21 @@ func CreateHistogram(ns, ss, name, help string, buckets []float64) prometheus.Hi
 	return histogram
 }
 
+// CreateHistogramVec registers a custom histogram partitioned by labels.
+func CreateHistogramVec(ns, ss, name, help string, buckets []float64, labels []string) *prometheus.HistogramVec {
+	opts := prometheus.HistogramOpts{
+		Namespace: ns,
+		Subsystem: ss,
+		Name:      name,
+		Help:      help,
+		Buckets:   buckets,
+	}
+
+	histogram := prometheus.NewHistogramVec(opts, labels)
+	registry.MustRegister(histogram)
+	return histogram
+}
+
 // CreateSummary registers a custom summary.
 func CreateSummary(ns, ss, name, help string, obj map[float64]float64) prometheus.Summary {
 	opts := prometheus.SummaryOpts{
@@ -10,6 +10,9 @@ import (
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	redis "github.com/redis/go-redis/v9"
+
+	"github.com/Shoowa/vamos/config"
+	"github.com/Shoowa/vamos/data/rdbms"
 )
 
 const (
@@ -37,10 +40,18 @@ type Option func(*Backbone)
 // Backbone holds dependencies that can eventually be accessed by a
 // http.Handler.
 type Backbone struct {
-	Cache        *redis.Client
+	Cache *redis.Client
+	// Databases holds a pool for every configured database, found by name.
+	Databases *rdbms.Registry
+	// Cluster routes reads to replicas of a primary.
+	Cluster *rdbms.Cluster
+	// DbHandle is the first database of the Registry, or a single pool added
+	// by WithDbHandle.
 	DbHandle     *pgxpool.Pool
 	Logger       *slog.Logger
 	HeapSnapshot *bytes.Buffer
+	Watcher      *config.Watcher
+	HealthChecks []HealthCheck
 }
 
 // NewBackbone employs the Options pattern to selectively configure the Backbone
@@ -71,6 +82,24 @@ func WithDbHandle(dbHandle *pgxpool.Pool) Option {
 	}
 }
 
+// WithDatabases selectively adds a Registry of Postgres pools to the Backbone
+// struct. Health checks ping every database in it. The first database also
+// becomes the DbHandle.
+func WithDatabases(registry *rdbms.Registry) Option {
+	return func(b *Backbone) {
+		b.Databases = registry
+		b.DbHandle = registry.Default()
+	}
+}
+
+// WithCluster selectively adds a primary & its replicas to the Backbone struct.
+// Pass it to sqlc as the DBTX, and mark read-only queries with rdbms.ReadOnly.
+func WithCluster(cluster *rdbms.Cluster) Option {
+	return func(b *Backbone) {
+		b.Cluster = cluster
+	}
+}
+
 // WithCache selectively adds a Redis client to the Backbone struct.
 func WithCache(client *redis.Client) Option {
 	return func(b *Backbone) {
@@ -78,6 +107,23 @@ func WithCache(client *redis.Client) Option {
 	}
 }
 
+// WithWatcher selectively adds a config.Watcher to the Backbone struct. The
+// router subscribes to it, so that the rate limiter, CORF origins, and health
+// thresholds adopt a reloaded Config without a restart.
+func WithWatcher(w *config.Watcher) Option {
+	return func(b *Backbone) {
+		b.Watcher = w
+	}
+}
+
+// WithHealthCheck selectively adds a named check to the /health endpoint. The
+// check must be cheap, because it is evaluated on every request to /health.
+func WithHealthCheck(name string, pass func() bool) Option {
+	return func(b *Backbone) {
+		b.HealthChecks = append(b.HealthChecks, HealthCheck{name, pass})
+	}
+}
+
 // ServerError logs an error, then produces a HTTP response appropriate for
 // common errors.
 func (b *Backbone) ServerError(w http.ResponseWriter, r *http.Request, err error) {
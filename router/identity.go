@@ -0,0 +1,105 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// PeerIdentity summarizes the verified client certificate of a caller. It is
+// only available when the server verifies client certificates, i.e., in the
+// mtls mode, or with httpserver.client_auth.
+type PeerIdentity struct {
+	// CommonName is the CN of the certificate subject.
+	CommonName string
+	// DNSNames are the DNS subject alternative names.
+	DNSNames []string
+	// URIs are the URI subject alternative names.
+	URIs []string
+	// SpiffeID is the first URI using the spiffe scheme, when present.
+	SpiffeID string
+}
+
+// Names lists every identity of the peer that an allowlist can match.
+func (p *PeerIdentity) Names() []string {
+	names := []string{}
+	if p.CommonName != "" {
+		names = append(names, p.CommonName)
+	}
+	names = append(names, p.DNSNames...)
+	return append(names, p.URIs...)
+}
+
+// Matches reports whether the peer holds an identity in the allowlist. An
+// entry ending with /* matches any identity beginning with the prefix, e.g.,
+// spiffe://example.org/ns/payments/*
+func (p *PeerIdentity) Matches(allow []string) bool {
+	for _, name := range p.Names() {
+		for _, entry := range allow {
+			prefix, wildcard := strings.CutSuffix(entry, "*")
+			if wildcard && strings.HasSuffix(prefix, "/") && strings.HasPrefix(name, prefix) {
+				return true
+			}
+			if name == entry {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type peerKey struct{}
+
+// PeerFromContext returns the verified identity of the caller, if any.
+func PeerFromContext(ctx context.Context) (*PeerIdentity, bool) {
+	peer, ok := ctx.Value(peerKey{}).(*PeerIdentity)
+	return peer, ok
+}
+
+// IdentifyPeers adds the identity of a verified client certificate to the
+// request context. Unverified certificates are ignored. NewRouter applies it to
+// every route.
+func IdentifyPeers(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		leaf := r.TLS.VerifiedChains[0][0]
+		peer := &PeerIdentity{
+			CommonName: leaf.Subject.CommonName,
+			DNSNames:   slices.Clone(leaf.DNSNames),
+		}
+		for _, uri := range leaf.URIs {
+			peer.URIs = append(peer.URIs, uri.String())
+			if uri.Scheme == "spiffe" && peer.SpiffeID == "" {
+				peer.SpiffeID = uri.String()
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), peerKey{}, peer)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequirePeer guards a single route with an allowlist of peer identities. A
+// caller lacking a verified client certificate receives 401, and a caller
+// absent from the allowlist receives 403.
+//
+//	{"GET /internal/report", router.RequirePeer(allowed, d.report)}
+func RequirePeer(allow []string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		peer, ok := PeerFromContext(r.Context())
+		if !ok {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		if !peer.Matches(allow) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
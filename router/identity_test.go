@@ -0,0 +1,64 @@
+//go:build !integration
+
+package router_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	. "github.com/Shoowa/vamos/router"
+	. "github.com/Shoowa/vamos/testhelper"
+)
+
+// requestWithPeer fabricates a request carrying a verified client certificate.
+func requestWithPeer(cn string, uri string) *http.Request {
+	r := httptest.NewRequest("GET", "/internal", nil)
+	if cn == "" {
+		return r
+	}
+
+	spiffe, _ := url.Parse(uri)
+	leaf := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: cn},
+		DNSNames: []string{cn + ".internal"},
+		URIs:     []*url.URL{spiffe},
+	}
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{leaf}}}
+	return r
+}
+
+func Test_RequirePeer(t *testing.T) {
+	allow := []string{"billing.internal", "spiffe://example.org/ns/payments/*"}
+
+	var seen *PeerIdentity
+	guarded := IdentifyPeers(RequirePeer(allow, func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = PeerFromContext(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	cases := []struct {
+		name   string
+		cn     string
+		uri    string
+		status int
+	}{
+		{"no certificate", "", "", http.StatusUnauthorized},
+		{"DNS name allowed", "billing", "spiffe://example.org/ns/billing/sa/api", http.StatusNoContent},
+		{"SPIFFE prefix allowed", "ledger", "spiffe://example.org/ns/payments/sa/ledger", http.StatusNoContent},
+		{"not allowed", "intruder", "spiffe://example.org/ns/other/sa/x", http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		guarded.ServeHTTP(w, requestWithPeer(c.cn, c.uri))
+		Equals(t, c.status, w.Code)
+	}
+
+	Equals(t, "ledger", seen.CommonName)
+	Equals(t, "spiffe://example.org/ns/payments/sa/ledger", seen.SpiffeID)
+}
@@ -4,6 +4,7 @@ import (
 	"log/slog"
 	"net/http"
 	"strconv"
+	"sync/atomic"
 
 	"github.com/Shoowa/vamos/config"
 	"github.com/Shoowa/vamos/metrics"
@@ -63,12 +64,46 @@ func gaugeRequests(next http.Handler) http.Handler {
 }
 
 // prevent CORF mitigates Cross Origin Request Forgery.
-func preventCORF(cfg *config.PreventCORF, next http.Handler) http.Handler {
-	// Skip applying the CORF middleware when undesired.
-	if cfg.Active == false {
-		return next
+func preventCORF(cfg *config.PreventCORF, watcher *config.Watcher, next http.Handler) http.Handler {
+	if cfg == nil {
+		cfg = new(config.PreventCORF)
 	}
 
+	// Skip applying the CORF middleware when undesired, and when it can never
+	// be activated later.
+	if watcher == nil {
+		if cfg.Active == false {
+			return next
+		}
+		return createCORF(cfg).Handler(next)
+	}
+
+	// The list of trusted origins can't be shortened, so a reload replaces the
+	// whole CrossOriginProtection.
+	var active atomic.Bool
+	var protection atomic.Pointer[http.CrossOriginProtection]
+	active.Store(cfg.Active)
+	protection.Store(createCORF(cfg))
+	watcher.Subscribe(func(c *config.Config) {
+		corf := c.HttpServer.CheckCORF
+		if corf == nil {
+			active.Store(false)
+			return
+		}
+		protection.Store(createCORF(corf))
+		active.Store(corf.Active)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if active.Load() {
+			protection.Load().Handler(next).ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func createCORF(cfg *config.PreventCORF) *http.CrossOriginProtection {
 	protection := http.NewCrossOriginProtection()
 
 	// Add other domains when listed. This is optional.
@@ -80,7 +115,7 @@ func preventCORF(cfg *config.PreventCORF, next http.Handler) http.Handler {
 		protection.AddInsecureBypassPattern(paths)
 	}
 
-	return protection.Handler(next)
+	return protection
 }
 
 // Endpoint is a custom struct that can be used to create a menu of routes.
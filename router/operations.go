@@ -5,6 +5,7 @@ import (
 	"log/slog"
 	"runtime"
 	"runtime/pprof"
+	"sync/atomic"
 	"time"
 
 	"github.com/Shoowa/vamos/config"
@@ -34,18 +35,61 @@ type Health struct {
 	Rdbms    bool
 	Heap     bool
 	Routines bool
+
+	// Thresholds can be replaced by a reloaded Config.
+	heapLimit    atomic.Uint64
+	routineLimit atomic.Int64
+
+	// checks are added by other packages through WithHealthCheck.
+	checks []HealthCheck
+}
+
+// HealthCheck lets another component, e.g., a certificate manager, take part in
+// the /health endpoint. Pass is invoked on every request to /health, so it must
+// be as cheap as reading a boolean.
+type HealthCheck struct {
+	Name string
+	Pass func() bool
+}
+
+// applyThresholds reads the maximum heap size and the amount of goroutines
+// per processor.
+func (h *Health) applyThresholds(cfg *config.Health) {
+	h.heapLimit.Store(1024 * 1024 * cfg.HeapSize)
+	h.routineLimit.Store(int64(runtime.NumCPU() * cfg.RoutinesPerCore))
 }
 
 // PassFail evaluates the totality of dependencies and the application.
 func (h *Health) PassFail() bool {
-	return h.Rdbms && h.Heap && h.Routines
+	return h.Rdbms && h.Heap && h.Routines && len(h.Failing()) == 0
 }
 
-// Ping evaluates the ability to contact a Postgres server
+// Failing lists the names of added health checks that currently fail.
+func (h *Health) Failing() []string {
+	failing := []string{}
+	for _, check := range h.checks {
+		if !check.Pass() {
+			failing = append(failing, check.Name)
+		}
+	}
+	return failing
+}
+
+// Ping evaluates the ability to contact a Postgres server. With a Registry,
+// every database is pinged, and a single failure fails the health check.
 func (b *Backbone) PingDB(health *Health) {
 	timer, cancel := context.WithTimeout(context.Background(), TIMEOUT_PING)
 	defer cancel()
 
+	if b.Databases != nil {
+		failed := b.Databases.Ping(timer)
+		for name, err := range failed {
+			b.Logger.Error("Failed ping", "Rdbms", err.Error(), "database", name)
+		}
+		health.Rdbms = len(failed) == 0
+		return
+	}
+
 	err := b.DbHandle.Ping(timer)
 	if err != nil {
 		health.Rdbms = false
@@ -64,6 +108,7 @@ func setupHealthChecks(cfg *config.Config, b *Backbone) *Health {
 	health.Rdbms = false
 	health.Heap = true
 	health.Routines = true
+	health.checks = b.HealthChecks
 
 	// Report status of connection upon ignition.
 	b.PingDB(health)
@@ -72,13 +117,21 @@ func setupHealthChecks(cfg *config.Config, b *Backbone) *Health {
 	heapTimer := time.Duration(cfg.Health.HeapTimer)
 	routinesTimer := time.Duration(cfg.Health.RoutTimer)
 
+	// Thresholds are read on every evaluation, so a reloaded Config can adjust
+	// them. The timers remain fixed until a restart.
+	health.applyThresholds(cfg.Health)
+	if b.Watcher != nil {
+		b.Watcher.Subscribe(func(c *config.Config) { health.applyThresholds(c.Health) })
+	}
+
 	// Use closure to configure method CheckHeapSize.
-	heapSize := 1024 * 1024 * cfg.Health.HeapSize
-	checkHeapSize := func() { b.checkHeapSize(health, heapSize) }
+	checkHeapSize := func() { b.checkHeapSize(health, health.heapLimit.Load()) }
 
 	// Use closure to configure CheckNumRoutines.
-	limit := runtime.NumCPU() * cfg.Health.RoutinesPerCore
-	checkNumRoutines := func() { checkNumRoutines(health, limit, b.Logger) }
+	checkNumRoutines := func() {
+		limit := int(health.routineLimit.Load())
+		checkNumRoutines(health, limit, b.Logger)
+	}
 
 	// Use  closure to add the Health Record to the pinger.
 	pingDB := func() { b.PingDB(health) }
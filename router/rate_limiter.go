@@ -2,6 +2,7 @@ package router
 
 import (
 	"net/http"
+	"sync/atomic"
 
 	"github.com/Shoowa/vamos/config"
 
@@ -24,11 +25,49 @@ func Limit(limiter *rate.Limiter, next http.Handler) http.Handler {
 	})
 }
 
-func optionalGlobalRateLimiter(cfg *config.RateLimiter, next http.Handler) http.Handler {
-	if cfg.Active == false {
-		return next
+// globalLimiter can be toggled and retuned while the server runs. The
+// rate.Limiter is safe to adjust concurrently.
+type globalLimiter struct {
+	active  atomic.Bool
+	limiter *rate.Limiter
+}
+
+func (g *globalLimiter) apply(cfg *config.RateLimiter) {
+	g.active.Store(cfg.Active)
+	g.limiter.SetLimit(rate.Limit(cfg.Average))
+	g.limiter.SetBurst(cfg.Burst)
+}
+
+func optionalGlobalRateLimiter(cfg *config.RateLimiter, watcher *config.Watcher, next http.Handler) http.Handler {
+	if cfg == nil {
+		cfg = new(config.RateLimiter)
 	}
 
-	limiter := CreateRateLimiter(cfg)
-	return Limit(limiter, next)
+	// Without a watcher, the limiter can never be activated later.
+	if watcher == nil {
+		if cfg.Active == false {
+			return next
+		}
+		limiter := CreateRateLimiter(cfg)
+		return Limit(limiter, next)
+	}
+
+	g := &globalLimiter{limiter: CreateRateLimiter(cfg)}
+	g.active.Store(cfg.Active)
+	watcher.Subscribe(func(c *config.Config) {
+		if c.HttpServer.GlobalRateLimiter != nil {
+			g.apply(c.HttpServer.GlobalRateLimiter)
+		} else {
+			g.active.Store(false)
+		}
+	})
+
+	limited := Limit(g.limiter, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if g.active.Load() {
+			limited.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
@@ -13,6 +13,7 @@ import (
 // router, and this interface allows for the easy creation of a server in both
 // production and testing.
 func NewRouter(cfg *config.Config, b Gatherer) http.Handler {
+	watcher := b.GetBackbone().Watcher
 	health := setupHealthChecks(cfg, b.GetBackbone())
 	mux := http.NewServeMux()
 
@@ -33,12 +34,13 @@ func NewRouter(cfg *config.Config, b Gatherer) http.Handler {
 	}
 
 	// Add mandatory middleware.
-	responseRecordingMW := recordResponses(mux)
+	identityMW := IdentifyPeers(mux)
+	responseRecordingMW := recordResponses(identityMW)
 	loggingMW := logRequests(b.GetLogger(), responseRecordingMW)
 	gaugingMW := gaugeRequests(loggingMW)
 
 	// Add optional middleware or stop at gaugeMW.
-	corfMW := preventCORF(cfg.HttpServer.CheckCORF, gaugingMW)
-	finalMW := optionalGlobalRateLimiter(cfg.HttpServer.GlobalRateLimiter, corfMW)
+	corfMW := preventCORF(cfg.HttpServer.CheckCORF, watcher, gaugingMW)
+	finalMW := optionalGlobalRateLimiter(cfg.HttpServer.GlobalRateLimiter, watcher, corfMW)
 	return finalMW
 }
@@ -23,7 +23,7 @@ func assessHealth(health *Health, logger *slog.Logger) http.HandlerFunc {
 		if status {
 			w.WriteHeader(http.StatusNoContent)
 		} else {
-			logger.Error("Failed health check")
+			logger.Error("Failed health check", "failing", health.Failing())
 			w.WriteHeader(http.StatusServiceUnavailable)
 		}
 	}
@@ -0,0 +1,48 @@
+package totp
+
+import (
+	"context"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// RedisGuard keeps attempts & used codes in Redis, so every replica of the
+// application shares them.
+type RedisGuard struct {
+	client      *redis.Client
+	maxAttempts int
+	window      time.Duration
+}
+
+// NewRedisGuard allows maxAttempts codes per account during a window.
+func NewRedisGuard(client *redis.Client, maxAttempts int, window time.Duration) *RedisGuard {
+	return &RedisGuard{client, maxAttempts, window}
+}
+
+func attemptsKey(id string) string {
+	return "totp:attempts:" + id
+}
+
+// Attempt increments the attempts of an account. The window begins with the
+// first attempt.
+func (g *RedisGuard) Attempt(ctx context.Context, id string) (bool, error) {
+	key := attemptsKey(id)
+	pipe := g.client.TxPipeline()
+	count := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, g.window)
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+	return count.Val() <= int64(g.maxAttempts), nil
+}
+
+func (g *RedisGuard) Reset(ctx context.Context, id string) error {
+	return g.client.Del(ctx, attemptsKey(id)).Err()
+}
+
+// Claim remembers a code for the REPLAY_WINDOW.
+func (g *RedisGuard) Claim(ctx context.Context, id string, code string) (bool, error) {
+	return g.client.SetNX(ctx, "totp:used:"+id+":"+code, 1, REPLAY_WINDOW).Result()
+}
@@ -0,0 +1,60 @@
+//go:build integration
+
+package totp_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Shoowa/vamos/config"
+	"github.com/Shoowa/vamos/data/cache"
+	. "github.com/Shoowa/vamos/router/totp"
+	"github.com/Shoowa/vamos/secrets"
+	. "github.com/Shoowa/vamos/testhelper"
+)
+
+func TestMain(m *testing.M) {
+	os.Setenv("APP_ENV", "DEV")
+	Change_to_project_root()
+	os.Unsetenv("APP_ENV")
+
+	code := m.Run()
+	os.Exit(code)
+}
+
+func Test_RedisGuard(t *testing.T) {
+	t.Setenv("APP_ENV", "DEV")
+	t.Setenv("OPENBAO_TOKEN", "token")
+
+	cfg, cfgErr := config.Read()
+	Ok(t, cfgErr)
+	sk := new(secrets.SkeletonKey)
+	sk.Create(cfg)
+
+	client, clientErr := cache.CreateClient(cfg, sk)
+	Ok(t, clientErr)
+	t.Cleanup(func() { cache.Close(client) })
+
+	ctx := t.Context()
+	id := "guard-test-" + time.Now().Format("150405.000000")
+	guard := NewRedisGuard(client, 2, time.Minute)
+	t.Cleanup(func() { guard.Reset(ctx, id) })
+
+	for _, expected := range []bool{true, true, false} {
+		allowed, attemptErr := guard.Attempt(ctx, id)
+		Ok(t, attemptErr)
+		Equals(t, expected, allowed)
+	}
+	Ok(t, guard.Reset(ctx, id))
+	allowed, attemptErr := guard.Attempt(ctx, id)
+	Ok(t, attemptErr)
+	Assert(t, allowed, "Expected attempts to be reset.")
+
+	fresh, claimErr := guard.Claim(ctx, id, "123456")
+	Ok(t, claimErr)
+	Assert(t, fresh, "Expected an unused code.")
+	fresh, claimErr = guard.Claim(ctx, id, "123456")
+	Ok(t, claimErr)
+	Assert(t, !fresh, "Expected a replayed code.")
+}
@@ -0,0 +1,360 @@
+// Package totp offers optional HTTP endpoints to enroll, confirm, verify, and
+// disable a TOTP second factor. The keys reside in the Openbao TOTP Engine.
+package totp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/Shoowa/vamos/metrics"
+	"github.com/Shoowa/vamos/router"
+	"github.com/Shoowa/vamos/secrets"
+)
+
+const (
+	// MAX_ATTEMPTS is the amount of failed codes an account may submit during
+	// the ATTEMPT_WINDOW.
+	MAX_ATTEMPTS = 5
+	// ATTEMPT_WINDOW begins with the first failed code of an account.
+	ATTEMPT_WINDOW = time.Minute * 15
+	// REPLAY_WINDOW is how long an accepted code is remembered, so it can't be
+	// accepted twice. It outlasts the period and skew of a TOTP code.
+	REPLAY_WINDOW = time.Second * 90
+	// KEY_PREFIX begins the name of every key in the TOTP Engine.
+	KEY_PREFIX = "account-"
+)
+
+// ErrNoAccount is returned by an Accounts lookup when the request lacks a
+// signed-in account. The caller receives 401.
+var ErrNoAccount = errors.New("No account signed in.")
+
+// validId restricts account IDs to characters that are safe in an Openbao path.
+var validId = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// attempts counts verifications by action & result.
+var attempts = metrics.CreateCounterVec(
+	"vamos", "totp", "attempts_total",
+	"Amount of TOTP codes submitted, by action & result.",
+	[]string{"action", "result"},
+)
+
+// Account is the part of a user the TOTP endpoints need.
+type Account struct {
+	// Id is unique & stable. It names the key in the TOTP Engine.
+	Id string
+	// Name is displayed in the authenticator app, e.g., an e-mail address.
+	Name string
+	// Enrolled is true after a code confirmed the enrollment.
+	Enrolled bool
+}
+
+// Accounts connects the TOTP endpoints to the account storage of an
+// application.
+type Accounts interface {
+	// Lookup identifies the account of a request, e.g., from a session. It
+	// returns ErrNoAccount when nobody is signed in.
+	Lookup(r *http.Request) (*Account, error)
+	// SetEnrolled records whether TOTP is required from the account.
+	SetEnrolled(ctx context.Context, id string, enrolled bool) error
+}
+
+// Engine is the part of the SkeletonKey used by the TOTP endpoints.
+type Engine interface {
+	OTPdraftPayload(generate bool) secrets.OtpPayload
+	OTPcreateKeyContext(ctx context.Context, data secrets.OtpPayload) (*secrets.OtpKey, error)
+	OTPdeleteKeyContext(ctx context.Context, data secrets.OtpPayload) error
+	OTPdraftCode(name string, code string) secrets.OtpCode
+	OTPverifyCodeContext(ctx context.Context, data secrets.OtpCode) (bool, error)
+}
+
+// Guard limits failed attempts per account, and rejects a code that was
+// already accepted. RedisGuard is the default.
+type Guard interface {
+	// Attempt counts a submitted code, and reports whether the account may
+	// still submit codes.
+	Attempt(ctx context.Context, id string) (bool, error)
+	// Reset forgets the attempts of an account after a valid code.
+	Reset(ctx context.Context, id string) error
+	// Claim marks a code as used, and reports whether it was unused.
+	Claim(ctx context.Context, id string, code string) (bool, error)
+}
+
+// Module serves the TOTP endpoints.
+type Module struct {
+	engine      Engine
+	accounts    Accounts
+	backbone    *router.Backbone
+	guard       Guard
+	issuer      string
+	maxAttempts int
+	window      time.Duration
+}
+
+// Option allows us to selectively configure the Module.
+type Option func(*Module)
+
+// WithIssuer names the organization displayed in the authenticator app.
+func WithIssuer(issuer string) Option {
+	return func(m *Module) {
+		m.issuer = issuer
+	}
+}
+
+// WithAttempts replaces MAX_ATTEMPTS & ATTEMPT_WINDOW.
+func WithAttempts(maxAttempts int, window time.Duration) Option {
+	return func(m *Module) {
+		m.maxAttempts = maxAttempts
+		m.window = window
+	}
+}
+
+// WithGuard replaces the RedisGuard, e.g., in tests.
+func WithGuard(g Guard) Option {
+	return func(m *Module) {
+		m.guard = g
+	}
+}
+
+// New creates the TOTP endpoints. The Backbone supplies the logger, and the
+// Redis client of the default RedisGuard.
+func New(engine Engine, accounts Accounts, b *router.Backbone, options ...Option) *Module {
+	m := &Module{
+		engine:      engine,
+		accounts:    accounts,
+		backbone:    b,
+		issuer:      "vamos",
+		maxAttempts: MAX_ATTEMPTS,
+		window:      ATTEMPT_WINDOW,
+	}
+	for _, opt := range options {
+		opt(m)
+	}
+	if m.guard == nil {
+		m.guard = NewRedisGuard(b.Cache, m.maxAttempts, m.window)
+	}
+	return m
+}
+
+// Endpoints lists the routes below a prefix, e.g., /account/totp. Add them to
+// the endpoints of the Gatherer.
+//
+//	POST {prefix}/enroll   creates a key, and returns its barcode & URL.
+//	POST {prefix}/confirm  accepts the first code, and enables TOTP.
+//	POST {prefix}/verify   accepts a code from an enrolled account.
+//	POST {prefix}/disable  accepts a code, then removes the key.
+func (m *Module) Endpoints(prefix string) []router.Endpoint {
+	return []router.Endpoint{
+		{VerbAndPath: "POST " + prefix + "/enroll", Handler: m.enroll},
+		{VerbAndPath: "POST " + prefix + "/confirm", Handler: m.confirm},
+		{VerbAndPath: "POST " + prefix + "/verify", Handler: m.verify},
+		{VerbAndPath: "POST " + prefix + "/disable", Handler: m.disable},
+	}
+}
+
+func keyName(id string) (string, error) {
+	if !validId.MatchString(id) {
+		return "", fmt.Errorf("Account ID %q can't name a TOTP key.", id)
+	}
+	return KEY_PREFIX + id, nil
+}
+
+// account identifies the caller, and replies when that fails.
+func (m *Module) account(w http.ResponseWriter, r *http.Request) (*Account, bool) {
+	account, err := m.accounts.Lookup(r)
+	if errors.Is(err, ErrNoAccount) {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return nil, false
+	}
+	if err != nil {
+		m.backbone.ServerError(w, r, err)
+		return nil, false
+	}
+	return account, true
+}
+
+type enrollment struct {
+	Barcode string `json:"barcode"`
+	Url     string `json:"url"`
+}
+
+// enroll generates a new key for an account lacking TOTP. Enrolling again
+// before confirming replaces the key.
+func (m *Module) enroll(w http.ResponseWriter, r *http.Request) {
+	account, ok := m.account(w, r)
+	if !ok {
+		return
+	}
+	if account.Enrolled {
+		http.Error(w, "TOTP already enabled", http.StatusConflict)
+		return
+	}
+
+	name, nameErr := keyName(account.Id)
+	if nameErr != nil {
+		m.backbone.ServerError(w, r, nameErr)
+		return
+	}
+
+	data := m.engine.OTPdraftPayload(true)
+	data.Name = name
+	data.Issuer = m.issuer
+	data.AccountName = account.Name
+
+	key, keyErr := m.engine.OTPcreateKeyContext(r.Context(), data)
+	if keyErr != nil {
+		m.backbone.ServerError(w, r, keyErr)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(enrollment{key.Barcode, key.Url})
+}
+
+// confirm enables TOTP once the account proves it holds the new key.
+func (m *Module) confirm(w http.ResponseWriter, r *http.Request) {
+	account, ok := m.account(w, r)
+	if !ok {
+		return
+	}
+	if account.Enrolled {
+		http.Error(w, "TOTP already enabled", http.StatusConflict)
+		return
+	}
+	if !m.check(w, r, "confirm", account) {
+		return
+	}
+
+	err := m.accounts.SetEnrolled(r.Context(), account.Id, true)
+	if err != nil {
+		m.backbone.ServerError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verify accepts a code from an enrolled account, e.g., during sign in.
+func (m *Module) verify(w http.ResponseWriter, r *http.Request) {
+	account, ok := m.account(w, r)
+	if !ok {
+		return
+	}
+	if !account.Enrolled {
+		http.Error(w, "TOTP not enabled", http.StatusConflict)
+		return
+	}
+	if !m.check(w, r, "verify", account) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// disable removes the key of an enrolled account, after a valid code.
+func (m *Module) disable(w http.ResponseWriter, r *http.Request) {
+	account, ok := m.account(w, r)
+	if !ok {
+		return
+	}
+	if !account.Enrolled {
+		http.Error(w, "TOTP not enabled", http.StatusConflict)
+		return
+	}
+	if !m.check(w, r, "disable", account) {
+		return
+	}
+
+	enrollErr := m.accounts.SetEnrolled(r.Context(), account.Id, false)
+	if enrollErr != nil {
+		m.backbone.ServerError(w, r, enrollErr)
+		return
+	}
+
+	data := m.engine.OTPdraftPayload(false)
+	data.Name, _ = keyName(account.Id)
+	deleteErr := m.engine.OTPdeleteKeyContext(r.Context(), data)
+	if deleteErr != nil {
+		m.backbone.ServerError(w, r, deleteErr)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type codeRequest struct {
+	Code string `json:"code"`
+}
+
+// check reads a code from the request body, and replies unless the code is
+// valid. Every outcome is counted.
+func (m *Module) check(w http.ResponseWriter, r *http.Request, action string, account *Account) bool {
+	var body codeRequest
+	decodeErr := json.NewDecoder(r.Body).Decode(&body)
+	if decodeErr != nil || body.Code == "" {
+		http.Error(w, "Missing code", http.StatusBadRequest)
+		return false
+	}
+
+	name, nameErr := keyName(account.Id)
+	if nameErr != nil {
+		m.backbone.ServerError(w, r, nameErr)
+		return false
+	}
+
+	ctx := r.Context()
+	allowed, attemptErr := m.guard.Attempt(ctx, account.Id)
+	if attemptErr != nil {
+		m.backbone.ServerError(w, r, attemptErr)
+		return false
+	}
+	if !allowed {
+		attempts.WithLabelValues(action, "limited").Inc()
+		m.backbone.Logger.Warn("TOTP attempts exceeded", "action", action, "account", account.Id)
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		return false
+	}
+
+	// The TOTP Engine rejects a code it already accepted, even before the
+	// guard remembers it.
+	valid, verifyErr := m.engine.OTPverifyCodeContext(ctx, m.engine.OTPdraftCode(name, body.Code))
+	if errors.Is(verifyErr, secrets.ErrCodeUsed) {
+		m.replayed(w, action, account)
+		return false
+	}
+	if verifyErr != nil {
+		m.backbone.ServerError(w, r, verifyErr)
+		return false
+	}
+	if !valid {
+		attempts.WithLabelValues(action, "failure").Inc()
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return false
+	}
+
+	fresh, claimErr := m.guard.Claim(ctx, account.Id, body.Code)
+	if claimErr != nil {
+		m.backbone.ServerError(w, r, claimErr)
+		return false
+	}
+	if !fresh {
+		m.replayed(w, action, account)
+		return false
+	}
+
+	resetErr := m.guard.Reset(ctx, account.Id)
+	if resetErr != nil {
+		m.backbone.Logger.Error("TOTP attempts not reset", "account", account.Id, "ERR:", resetErr.Error())
+	}
+	attempts.WithLabelValues(action, "success").Inc()
+	return true
+}
+
+// replayed refuses a code that was already accepted.
+func (m *Module) replayed(w http.ResponseWriter, action string, account *Account) {
+	attempts.WithLabelValues(action, "replay").Inc()
+	m.backbone.Logger.Warn("TOTP code replayed", "action", action, "account", account.Id)
+	http.Error(w, "Invalid code", http.StatusUnauthorized)
+}
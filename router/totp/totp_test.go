@@ -0,0 +1,164 @@
+//go:build !integration
+
+package totp_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Shoowa/vamos/router"
+	. "github.com/Shoowa/vamos/router/totp"
+	"github.com/Shoowa/vamos/secrets"
+	. "github.com/Shoowa/vamos/testhelper"
+)
+
+// USED_CODE is refused by the fakeEngine, like the TOTP Engine refuses a code
+// it already accepted.
+const USED_CODE = "654321"
+
+// fakeEngine accepts the code 123456 for any existing key.
+type fakeEngine struct {
+	keys map[string]secrets.OtpPayload
+}
+
+func (f *fakeEngine) OTPdraftPayload(generate bool) secrets.OtpPayload {
+	return secrets.OtpPayload{Path: "totp/keys/", Generate: generate, Exported: generate}
+}
+
+func (f *fakeEngine) OTPcreateKeyContext(ctx context.Context, data secrets.OtpPayload) (*secrets.OtpKey, error) {
+	f.keys[data.Name] = data
+	return &secrets.OtpKey{Barcode: "png", Url: "otpauth://totp/" + data.Issuer + ":" + data.AccountName}, nil
+}
+
+func (f *fakeEngine) OTPdeleteKeyContext(ctx context.Context, data secrets.OtpPayload) error {
+	delete(f.keys, data.Name)
+	return nil
+}
+
+func (f *fakeEngine) OTPdraftCode(name string, code string) secrets.OtpCode {
+	return secrets.OtpCode{Path: "totp/code/", Name: name, Code: code}
+}
+
+func (f *fakeEngine) OTPverifyCodeContext(ctx context.Context, data secrets.OtpCode) (bool, error) {
+	if data.Code == USED_CODE {
+		used := errors.New("code already used; wait until the next time period")
+		return false, &secrets.Error{Op: "write", Path: data.Path + data.Name, Kind: secrets.ErrCodeUsed, Err: used}
+	}
+	_, found := f.keys[data.Name]
+	return found && data.Code == "123456", nil
+}
+
+// fakeAccounts signs in the account named by the header X-Account.
+type fakeAccounts map[string]*Account
+
+func (f fakeAccounts) Lookup(r *http.Request) (*Account, error) {
+	account, found := f[r.Header.Get("X-Account")]
+	if !found {
+		return nil, ErrNoAccount
+	}
+	return account, nil
+}
+
+func (f fakeAccounts) SetEnrolled(ctx context.Context, id string, enrolled bool) error {
+	f[id].Enrolled = enrolled
+	return nil
+}
+
+// memoryGuard stands in for Redis.
+type memoryGuard struct {
+	max      int
+	attempts map[string]int
+	used     map[string]bool
+}
+
+func (g *memoryGuard) Attempt(ctx context.Context, id string) (bool, error) {
+	g.attempts[id]++
+	return g.attempts[id] <= g.max, nil
+}
+
+func (g *memoryGuard) Reset(ctx context.Context, id string) error {
+	delete(g.attempts, id)
+	return nil
+}
+
+func (g *memoryGuard) Claim(ctx context.Context, id string, code string) (bool, error) {
+	fresh := !g.used[id+code]
+	g.used[id+code] = true
+	return fresh, nil
+}
+
+func TestMain(m *testing.M) {
+	Change_to_project_root()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func Test_TotpFlow(t *testing.T) {
+	engine := &fakeEngine{keys: map[string]secrets.OtpPayload{}}
+	accounts := fakeAccounts{"ada": {Id: "ada", Name: "ada@example.org"}}
+	guard := &memoryGuard{max: 2, attempts: map[string]int{}, used: map[string]bool{}}
+	var logs bytes.Buffer
+	backbone := router.NewBackbone(router.WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+
+	module := New(engine, accounts, backbone, WithIssuer("Example"), WithGuard(guard))
+	mux := http.NewServeMux()
+	for _, endpoint := range module.Endpoints("/account/totp") {
+		mux.HandleFunc(endpoint.VerbAndPath, endpoint.Handler)
+	}
+
+	post := func(account, path, code string) *httptest.ResponseRecorder {
+		body := ""
+		if code != "" {
+			body = `{"code":"` + code + `"}`
+		}
+		r := httptest.NewRequest("POST", "/account/totp"+path, strings.NewReader(body))
+		r.Header.Set("X-Account", account)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	Equals(t, http.StatusUnauthorized, post("nobody", "/enroll", "").Code)
+	Equals(t, http.StatusConflict, post("ada", "/verify", "123456").Code)
+
+	enrolled := post("ada", "/enroll", "")
+	Equals(t, http.StatusOK, enrolled.Code)
+	Equals(t, "no-store", enrolled.Header().Get("Cache-Control"))
+	var key struct{ Barcode, Url string }
+	Ok(t, json.NewDecoder(enrolled.Body).Decode(&key))
+	Equals(t, "otpauth://totp/Example:ada@example.org", key.Url)
+	Equals(t, "Example", engine.keys[KEY_PREFIX+"ada"].Issuer)
+
+	Equals(t, http.StatusBadRequest, post("ada", "/confirm", "").Code)
+	Equals(t, http.StatusUnauthorized, post("ada", "/confirm", "000000").Code)
+	Equals(t, http.StatusNoContent, post("ada", "/confirm", "123456").Code)
+	Assert(t, accounts["ada"].Enrolled, "Expected a confirmed enrollment.")
+
+	// A valid code is only accepted once.
+	Equals(t, http.StatusUnauthorized, post("ada", "/verify", "123456").Code)
+
+	// Attempts beyond the limit are refused, even with a valid code.
+	Equals(t, http.StatusUnauthorized, post("ada", "/verify", "000000").Code)
+	guard.used = map[string]bool{}
+	Equals(t, http.StatusTooManyRequests, post("ada", "/verify", "123456").Code)
+	guard.attempts = map[string]int{}
+	Equals(t, http.StatusNoContent, post("ada", "/verify", "123456").Code)
+
+	// A code the TOTP Engine already accepted is a replay, not a failure of
+	// the server.
+	Equals(t, http.StatusUnauthorized, post("ada", "/verify", USED_CODE).Code)
+	Equals(t, 2, strings.Count(logs.String(), "TOTP code replayed"))
+
+	guard.used = map[string]bool{}
+	Equals(t, http.StatusNoContent, post("ada", "/disable", "123456").Code)
+	Assert(t, !accounts["ada"].Enrolled, "Expected TOTP to be disabled.")
+	Equals(t, 0, len(engine.keys))
+}
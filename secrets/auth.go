@@ -0,0 +1,294 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	openbao "github.com/openbao/openbao/api/v2"
+
+	"github.com/Shoowa/vamos/config"
+)
+
+const (
+	// AUTH_RETRY_MIN is the pause after the first failed attempt to log in, or
+	// to look up the token. It doubles with each failure.
+	AUTH_RETRY_MIN = time.Second
+	// AUTH_RETRY_WAIT is the longest pause between failed attempts.
+	AUTH_RETRY_WAIT = time.Second * 10
+	// TOKEN_FILE_INTERVAL is how often a token file is checked for a new token.
+	TOKEN_FILE_INTERVAL = time.Second * 30
+)
+
+// authMethod returns the configured method, or the token method when the
+// SkeletonKey was assembled without a Config.
+func (sk *SkeletonKey) authMethod() *config.OpenbaoAuth {
+	if sk.settings == nil || sk.settings.Auth == nil {
+		return &config.OpenbaoAuth{Method: config.AUTH_TOKEN}
+	}
+	return sk.settings.Auth
+}
+
+// Login obtains a token with the configured authentication method, and assigns
+// it to the Openbao client. The token & token_file methods read a token
+// without contacting Openbao.
+func (sk *SkeletonKey) Login() error {
+	auth := sk.authMethod()
+
+	var data payload
+	switch auth.Method {
+	case config.AUTH_TOKEN:
+		token := os.Getenv("OPENBAO_TOKEN")
+		if sk.settings != nil {
+			sk.settings.ReadToken()
+			token = sk.settings.Token
+		}
+		sk.Openbao.SetToken(token)
+		return nil
+	case config.AUTH_TOKEN_FILE:
+		token, tokenErr := readTokenFile(auth.TokenPath)
+		if tokenErr != nil {
+			return tokenErr
+		}
+		sk.Openbao.SetToken(token)
+		return nil
+	case config.AUTH_APPROLE:
+		data = payload{"role_id": auth.RoleId, "secret_id": auth.SecretId}
+	case config.AUTH_KUBERNETES:
+		jwt, jwtErr := os.ReadFile(auth.JwtPath)
+		if jwtErr != nil {
+			return jwtErr
+		}
+		data = payload{"role": auth.Role, "jwt": strings.TrimSpace(string(jwt))}
+	case config.AUTH_CERT:
+		data = payload{"name": auth.Role}
+	default:
+		return fmt.Errorf("Unknown Openbao auth method %q.", auth.Method)
+	}
+
+	// Log in with a clone lacking the old token, which might have expired.
+	anonymous, cloneErr := sk.Openbao.Clone()
+	if cloneErr != nil {
+		return cloneErr
+	}
+	anonymous.ClearToken()
+
+	secret, loginErr := anonymous.Logical().Write("auth/"+auth.Mount+"/login", data)
+	if loginErr != nil {
+		return loginErr
+	}
+	if secret == nil || secret.Auth == nil {
+		return errors.New("Openbao login returned no token.")
+	}
+
+	sk.Openbao.SetToken(secret.Auth.ClientToken)
+	sk.authSecret = secret
+	return nil
+}
+
+func readTokenFile(path string) (string, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(contents))
+	if token == "" {
+		return "", errors.New("Openbao token file is empty.")
+	}
+	return token, nil
+}
+
+// AuthHealthy reports false after the token could not be renewed, and a new
+// login failed. It is meant for router.WithHealthCheck.
+func (sk *SkeletonKey) AuthHealthy() bool {
+	return !sk.authFailed.Load()
+}
+
+// WatchAuth keeps the token of the Openbao client alive until the context is
+// cancelled. A renewable token is renewed before it expires. When it can't be
+// renewed any further, the client logs in again. A token file is read again
+// whenever it changes. Failures are logged, and reported by AuthHealthy.
+func (sk *SkeletonKey) WatchAuth(ctx context.Context, logger *slog.Logger) {
+	auth := sk.authMethod()
+	if auth.Method == config.AUTH_TOKEN_FILE {
+		sk.watchTokenFile(ctx, logger, auth.TokenPath)
+		return
+	}
+
+	for {
+		secret := sk.authSecret
+		if auth.Method == config.AUTH_TOKEN {
+			lookup, lookupErr := sk.lookupUntilDone(ctx, logger)
+			if errors.Is(lookupErr, errNotRenewable) {
+				logger.Info("Openbao token will not be renewed", "reason", lookupErr.Error())
+				return
+			}
+			if lookupErr != nil {
+				return
+			}
+			secret = lookup
+		}
+
+		expired := sk.renewUntilDone(ctx, logger, secret)
+		if !expired {
+			return
+		}
+
+		// A static token can't be replaced by the application.
+		if auth.Method == config.AUTH_TOKEN {
+			sk.authFailed.Store(true)
+			logger.Error("Openbao token can't be renewed any further")
+			return
+		}
+
+		if !sk.loginUntilDone(ctx, logger) {
+			return
+		}
+	}
+}
+
+// errNotRenewable means the static token never needs renewal, or can't have
+// it.
+var errNotRenewable = errors.New("Token lacks a TTL, or is not renewable.")
+
+// lookupUntilDone retries a lookup of the token until it succeeds, the token
+// turns out to be not renewable, or the context is cancelled.
+func (sk *SkeletonKey) lookupUntilDone(ctx context.Context, logger *slog.Logger) (*openbao.Secret, error) {
+	for attempt := 1; ; attempt++ {
+		secret, err := sk.lookupSelf()
+		if err == nil {
+			sk.authFailed.Store(false)
+			return secret, nil
+		}
+		if errors.Is(err, errNotRenewable) {
+			return nil, err
+		}
+
+		sk.authFailed.Store(true)
+		logger.Error("Openbao token lookup failed", "ERR:", err.Error())
+
+		waitErr := authBackoff(ctx, attempt)
+		if waitErr != nil {
+			return nil, waitErr
+		}
+	}
+}
+
+// authBackoff pauses after a failed attempt, unless the context ends first.
+func authBackoff(ctx context.Context, attempt int) error {
+	wait := min(AUTH_RETRY_MIN<<(attempt-1), AUTH_RETRY_WAIT)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// lookupSelf describes the current token as a renewable secret. A token
+// without a TTL, like a root token, never expires and needs no renewal.
+func (sk *SkeletonKey) lookupSelf() (*openbao.Secret, error) {
+	self, selfErr := sk.Openbao.Auth().Token().LookupSelf()
+	if selfErr != nil {
+		return nil, selfErr
+	}
+
+	ttl, ttlErr := self.TokenTTL()
+	if ttlErr != nil {
+		return nil, ttlErr
+	}
+	renewable, renewableErr := self.TokenIsRenewable()
+	if renewableErr != nil {
+		return nil, renewableErr
+	}
+	if ttl == 0 || !renewable {
+		return nil, errNotRenewable
+	}
+
+	auth := &openbao.SecretAuth{
+		ClientToken:   sk.Openbao.Token(),
+		Renewable:     renewable,
+		LeaseDuration: int(ttl.Seconds()),
+	}
+	return &openbao.Secret{Auth: auth}, nil
+}
+
+// renewUntilDone renews the token with a LifetimeWatcher. It returns true when
+// the token can't be renewed any further, and false when the context is
+// cancelled.
+func (sk *SkeletonKey) renewUntilDone(ctx context.Context, logger *slog.Logger, secret *openbao.Secret) bool {
+	watcher, watcherErr := sk.Openbao.NewLifetimeWatcher(&openbao.LifetimeWatcherInput{Secret: secret})
+	if watcherErr != nil {
+		logger.Error("Openbao token watcher failed", "ERR:", watcherErr.Error())
+		return true
+	}
+	go watcher.Start()
+	defer watcher.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case err := <-watcher.DoneCh():
+			if err != nil {
+				logger.Warn("Openbao token renewal stopped", "ERR:", err.Error())
+			}
+			return true
+		case <-watcher.RenewCh():
+			sk.authFailed.Store(false)
+			logger.Debug("Openbao token renewed")
+		}
+	}
+}
+
+// loginUntilDone retries a login until it succeeds, or the context is
+// cancelled.
+func (sk *SkeletonKey) loginUntilDone(ctx context.Context, logger *slog.Logger) bool {
+	for attempt := 1; ; attempt++ {
+		err := sk.Login()
+		if err == nil {
+			sk.authFailed.Store(false)
+			logger.Info("Openbao login renewed")
+			return true
+		}
+
+		sk.authFailed.Store(true)
+		logger.Error("Openbao login failed", "ERR:", err.Error())
+
+		if authBackoff(ctx, attempt) != nil {
+			return false
+		}
+	}
+}
+
+// watchTokenFile adopts a new token written to the file by an Openbao agent.
+func (sk *SkeletonKey) watchTokenFile(ctx context.Context, logger *slog.Logger, path string) {
+	ticker := time.NewTicker(TOKEN_FILE_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		token, err := readTokenFile(path)
+		if err != nil {
+			sk.authFailed.Store(true)
+			logger.Error("Openbao token file unreadable", "ERR:", err.Error())
+			continue
+		}
+		sk.authFailed.Store(false)
+		if token != sk.Openbao.Token() {
+			sk.Openbao.SetToken(token)
+			logger.Info("Openbao token file changed")
+		}
+	}
+}
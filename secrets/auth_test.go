@@ -0,0 +1,204 @@
+package secrets_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Shoowa/vamos/config"
+	. "github.com/Shoowa/vamos/secrets"
+	. "github.com/Shoowa/vamos/testhelper"
+)
+
+// fakeLogin stands in for the login endpoints of an Openbao server. It issues
+// a token named after the auth method.
+func fakeLogin(w http.ResponseWriter, r *http.Request) {
+	body := map[string]string{}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	token := ""
+	switch r.URL.Path {
+	case "/v1/auth/approle/login":
+		if body["role_id"] == "app" && body["secret_id"] == "shh" {
+			token = "s.approle"
+		}
+	case "/v1/auth/k8s/login":
+		if body["role"] == "web" && body["jwt"] == "header.claims.sig" {
+			token = "s.kubernetes"
+		}
+	}
+	if token == "" || r.Header.Get("X-Vault-Token") != "" {
+		http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"auth": map[string]any{"client_token": token, "renewable": true, "lease_duration": 3600},
+	})
+}
+
+func fakeOpenbaoConfig(t *testing.T, auth *config.OpenbaoAuth) *config.Config {
+	cfg := fakeConfig(t, http.HandlerFunc(fakeLogin))
+	cfg.Secrets.Openbao.Auth = auth
+	return cfg
+}
+
+// fakeConfig points the Openbao client at a stand-in server.
+func fakeConfig(t *testing.T, h http.Handler) *config.Config {
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	u, _ := url.Parse(srv.URL)
+	host, port, _ := net.SplitHostPort(u.Host)
+	return &config.Config{
+		Secrets: &config.Secrets{Openbao: config.Openbao{
+			Scheme:    "http",
+			Host:      host,
+			Port:      port,
+			TlsClient: &config.TlsSecret{Source: config.TLS_FILE},
+		}},
+	}
+}
+
+func Test_Login(t *testing.T) {
+	jwtPath := filepath.Join(t.TempDir(), "token")
+	Ok(t, os.WriteFile(jwtPath, []byte("header.claims.sig\n"), 0o600))
+
+	tokenPath := filepath.Join(t.TempDir(), "sink")
+	Ok(t, os.WriteFile(tokenPath, []byte("s.agent\n"), 0o600))
+
+	cases := []struct {
+		auth  *config.OpenbaoAuth
+		token string
+	}{
+		{&config.OpenbaoAuth{Method: config.AUTH_APPROLE, Mount: "approle", RoleId: "app", SecretId: "shh"}, "s.approle"},
+		{&config.OpenbaoAuth{Method: config.AUTH_KUBERNETES, Mount: "k8s", Role: "web", JwtPath: jwtPath}, "s.kubernetes"},
+		{&config.OpenbaoAuth{Method: config.AUTH_TOKEN_FILE, TokenPath: tokenPath}, "s.agent"},
+	}
+
+	for _, c := range cases {
+		sk := new(SkeletonKey)
+		sk.Create(fakeOpenbaoConfig(t, c.auth))
+		Equals(t, c.token, sk.Openbao.Token())
+		Assert(t, sk.AuthHealthy(), "Expected a healthy login with "+c.auth.Method)
+	}
+
+	sk := new(SkeletonKey)
+	sk.Create(fakeOpenbaoConfig(t, cases[0].auth))
+	sk.Openbao.SetToken("s.expired")
+	Ok(t, sk.Login())
+	Equals(t, "s.approle", sk.Openbao.Token())
+}
+
+// fakeTokens stands in for the token endpoints of an Openbao server. It issues
+// short leases, so a LifetimeWatcher acts within a test.
+type fakeTokens struct {
+	lease       int
+	failLookups int32
+	failRenewal bool
+	logins      atomic.Int32
+	lookups     atomic.Int32
+	renewals    atomic.Int32
+}
+
+func (f *fakeTokens) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	denied := `{"errors":["permission denied"]}`
+
+	switch r.URL.Path {
+	case "/v1/auth/approle/login":
+		n := f.logins.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{
+			"auth": map[string]any{"client_token": fmt.Sprintf("s.login%v", n), "renewable": true, "lease_duration": f.lease},
+		})
+	case "/v1/auth/token/lookup-self":
+		if f.lookups.Add(1) <= f.failLookups {
+			http.Error(w, denied, http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"data": map[string]any{"ttl": f.lease, "renewable": true},
+		})
+	case "/v1/auth/token/renew-self":
+		f.renewals.Add(1)
+		if f.failRenewal {
+			http.Error(w, denied, http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"auth": map[string]any{"client_token": r.Header.Get("X-Vault-Token"), "renewable": true, "lease_duration": f.lease},
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// watchAuth runs WatchAuth until the test ends.
+func watchAuth(t *testing.T, sk *SkeletonKey) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		sk.WatchAuth(ctx, slog.New(slog.DiscardHandler))
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// eventually polls a condition for a few seconds.
+func eventually(t *testing.T, condition func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second * 5)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func Test_WatchAuth_Renew(t *testing.T) {
+	t.Setenv("OPENBAO_TOKEN", "s.static")
+	fake := &fakeTokens{lease: 60, failLookups: 1}
+	cfg := fakeConfig(t, fake)
+	cfg.Secrets.Openbao.Auth = &config.OpenbaoAuth{Method: config.AUTH_TOKEN}
+
+	sk := new(SkeletonKey)
+	sk.Create(cfg)
+	watchAuth(t, sk)
+
+	eventually(t, func() bool { return !sk.AuthHealthy() }, "Expected a failed lookup to be unhealthy")
+	eventually(t, func() bool { return fake.renewals.Load() > 0 }, "Expected the lookup to be retried, and the token renewed")
+	eventually(t, sk.AuthHealthy, "Expected a renewal to be healthy")
+	Equals(t, int32(2), fake.lookups.Load())
+	Equals(t, "s.static", sk.Openbao.Token())
+}
+
+func Test_WatchAuth_Login(t *testing.T) {
+	fake := &fakeTokens{lease: 1, failRenewal: true}
+	cfg := fakeConfig(t, fake)
+	cfg.Secrets.Openbao.Auth = &config.OpenbaoAuth{Method: config.AUTH_APPROLE, Mount: "approle", RoleId: "app", SecretId: "shh"}
+
+	sk := new(SkeletonKey)
+	sk.Create(cfg)
+	Equals(t, "s.login1", sk.Openbao.Token())
+	watchAuth(t, sk)
+
+	eventually(t, func() bool { return fake.logins.Load() > 1 }, "Expected a login after the renewal failed")
+	Assert(t, fake.renewals.Load() > 0, "Expected a renewal before the login")
+	Assert(t, sk.Openbao.Token() != "s.login1", "Expected a new token")
+	Assert(t, sk.AuthHealthy(), "Expected a new login to be healthy")
+}
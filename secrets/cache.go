@@ -0,0 +1,94 @@
+package secrets
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// KV_CACHE_TTL is how long a value read from the KV engine is re-used, unless
+// secrets.openbao.cache_ttl says otherwise.
+const KV_CACHE_TTL = time.Second * 30
+
+// kvCache is a read-through cache of KV documents. Concurrent reads of the same
+// path share a single request to Openbao, so a pool refilling many connections
+// at once only reads a password once.
+type kvCache struct {
+	mu      sync.Mutex
+	entries map[string]kvEntry
+	group   singleflight.Group
+}
+
+type kvEntry struct {
+	data    map[string]any
+	expires time.Time
+}
+
+// cacheTtl decides how long a document is kept. A negative cache_ttl disables
+// caching, while concurrent reads are still shared.
+func (sk *SkeletonKey) cacheTtl() time.Duration {
+	if sk.settings == nil || sk.settings.CacheTtl == 0 {
+		return KV_CACHE_TTL
+	}
+	return time.Second * time.Duration(sk.settings.CacheTtl)
+}
+
+// readKv returns the data of a KV document from the cache, or from Openbao.
+// A lease shorter than the TTL shortens the time the document is kept.
+//
+// The shared read is detached from the cancellation of any single caller, and
+// bounded by the configured timeout instead. A cancelled caller stops waiting.
+func (sk *SkeletonKey) readKv(ctx context.Context, mount, secretPath string) (map[string]any, error) {
+	id := mount + "/" + secretPath
+
+	sk.kv.mu.Lock()
+	entry, found := sk.kv.entries[id]
+	sk.kv.mu.Unlock()
+	if found && time.Now().Before(entry.expires) {
+		return entry.data, nil
+	}
+
+	flight := sk.kv.group.DoChan(id, func() (any, error) {
+		callCtx, cancel := sk.callContext(context.WithoutCancel(ctx))
+		defer cancel()
+
+		secret, secretErr := sk.getKv(callCtx, mount, secretPath)
+		if secretErr != nil {
+			return nil, wrapErr("read", id, secretErr)
+		}
+
+		ttl := sk.cacheTtl()
+		if secret.Raw != nil && secret.Raw.LeaseDuration > 0 {
+			ttl = min(ttl, time.Second*time.Duration(secret.Raw.LeaseDuration))
+		}
+		if ttl > 0 {
+			sk.kv.mu.Lock()
+			if sk.kv.entries == nil {
+				sk.kv.entries = map[string]kvEntry{}
+			}
+			sk.kv.entries[id] = kvEntry{secret.Data, time.Now().Add(ttl)}
+			sk.kv.mu.Unlock()
+		}
+		return secret.Data, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, wrapErr("read", id, ctx.Err())
+	case result := <-flight:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return result.Val.(map[string]any), nil
+	}
+}
+
+// Forget removes a KV document from the cache, so the next read contacts
+// Openbao. It is useful after a secret is rotated.
+func (sk *SkeletonKey) Forget(mount, secretPath string) {
+	sk.kv.mu.Lock()
+	defer sk.kv.mu.Unlock()
+	delete(sk.kv.entries, mount+"/"+secretPath)
+}
@@ -0,0 +1,54 @@
+package secrets_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/Shoowa/vamos/testhelper"
+)
+
+func Test_ReadPathAndKey_SharesReads(t *testing.T) {
+	var reads atomic.Int32
+	kv := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/secret/data/dev-postgres-test" {
+			http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+			return
+		}
+		reads.Add(1)
+		// Hold the request, so that concurrent reads pile up.
+		time.Sleep(time.Millisecond * 50)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"data": map[string]any{"data": map[string]any{"password": "hunter2"}, "metadata": map[string]any{}},
+		})
+	}
+	sk := fakeSkeletonKey(t, http.HandlerFunc(kv))
+
+	// A pool refilling 50 connections at once.
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Go(func() {
+			pw, pwErr := sk.ReadPathAndKey("dev-postgres-test", "password")
+			Ok(t, pwErr)
+			Equals(t, "hunter2", pw)
+		})
+	}
+	wg.Wait()
+	Equals(t, int32(1), reads.Load())
+
+	_, cachedErr := sk.ReadPathAndKey("dev-postgres-test", "password")
+	Ok(t, cachedErr)
+	Equals(t, int32(1), reads.Load())
+
+	sk.Forget("secret", "dev-postgres-test")
+	_, freshErr := sk.ReadPathAndKey("dev-postgres-test", "password")
+	Ok(t, freshErr)
+	Equals(t, int32(2), reads.Load())
+
+	_, missingErr := sk.ReadPathAndKey("absent", "password")
+	Assert(t, missingErr != nil, "Expected an error from an absent secret.")
+}
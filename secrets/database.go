@@ -0,0 +1,89 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	openbao "github.com/openbao/openbao/api/v2"
+)
+
+// DbLease holds credentials leased from the Openbao database secrets engine.
+// The user & password stop working when the lease expires or is revoked.
+type DbLease struct {
+	Username string
+	Password string
+	// LeaseId identifies the lease for renewal & revocation.
+	LeaseId string
+	// Duration is the remaining lifetime of the lease when it was issued.
+	Duration time.Duration
+	// Renewable reports whether the lease can be extended.
+	Renewable bool
+	// Secret is the original response, suitable for a LifetimeWatcher.
+	Secret *openbao.Secret
+}
+
+// DBreadCreds leases a new user & password for a role of the database secrets
+// engine enabled at the mount.
+func (sk *SkeletonKey) DBreadCreds(mount, role string) (*DbLease, error) {
+	return sk.DBreadCredsContext(context.Background(), mount, role)
+}
+
+// DBreadCredsContext is DBreadCreds bounded by a context.
+func (sk *SkeletonKey) DBreadCredsContext(ctx context.Context, mount, role string) (*DbLease, error) {
+	secret, secretErr := sk.LogicalReadContext(ctx, mount+"/creds/"+role)
+	if secretErr != nil {
+		return nil, secretErr
+	}
+	if secret == nil {
+		return nil, errors.New("Openbao database engine returned no credentials.")
+	}
+
+	username, ok := secret.Data["username"].(string)
+	if !ok {
+		return nil, errors.New("Type assertion failed on the field USERNAME.")
+	}
+
+	password, ok := secret.Data["password"].(string)
+	if !ok {
+		return nil, errors.New("Type assertion failed on the field PASSWORD.")
+	}
+
+	lease := &DbLease{
+		Username:  username,
+		Password:  password,
+		LeaseId:   secret.LeaseID,
+		Duration:  time.Second * time.Duration(secret.LeaseDuration),
+		Renewable: secret.Renewable,
+		Secret:    secret,
+	}
+	return lease, nil
+}
+
+// RenewLease extends a lease by the increment, or by the default TTL of the
+// engine when the increment is zero.
+func (sk *SkeletonKey) RenewLease(leaseId string, increment time.Duration) error {
+	return sk.RenewLeaseContext(context.Background(), leaseId, increment)
+}
+
+// RenewLeaseContext is RenewLease bounded by a context.
+func (sk *SkeletonKey) RenewLeaseContext(ctx context.Context, leaseId string, increment time.Duration) error {
+	ctx, cancel := sk.callContext(ctx)
+	defer cancel()
+
+	_, renewErr := sk.Openbao.Sys().RenewWithContext(ctx, leaseId, int(increment.Seconds()))
+	return renewErr
+}
+
+// RevokeLease ends a lease immediately, so its credentials stop working.
+func (sk *SkeletonKey) RevokeLease(leaseId string) error {
+	return sk.RevokeLeaseContext(context.Background(), leaseId)
+}
+
+// RevokeLeaseContext is RevokeLease bounded by a context.
+func (sk *SkeletonKey) RevokeLeaseContext(ctx context.Context, leaseId string) error {
+	ctx, cancel := sk.callContext(ctx)
+	defer cancel()
+
+	return sk.Openbao.Sys().RevokeWithContext(ctx, leaseId)
+}
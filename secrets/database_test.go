@@ -0,0 +1,56 @@
+package secrets_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	. "github.com/Shoowa/vamos/testhelper"
+)
+
+func Test_DatabaseLease(t *testing.T) {
+	var renewed, revoked string
+	engine := func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]any{}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		resp := map[string]any{}
+		switch r.URL.Path {
+		case "/v1/database/creds/readonly":
+			resp["lease_id"] = "database/creds/readonly/abc"
+			resp["lease_duration"] = 3600
+			resp["renewable"] = true
+			resp["data"] = map[string]any{"username": "v-app-readonly-abc", "password": "A1a-secret"}
+		case "/v1/sys/leases/renew":
+			renewed, _ = body["lease_id"].(string)
+			resp["lease_id"] = renewed
+		case "/v1/sys/leases/revoke":
+			revoked, _ = body["lease_id"].(string)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		default:
+			http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+	sk := fakeSkeletonKey(t, http.HandlerFunc(engine))
+
+	lease, leaseErr := sk.DBreadCreds("database", "readonly")
+	Ok(t, leaseErr)
+	Equals(t, "v-app-readonly-abc", lease.Username)
+	Equals(t, "A1a-secret", lease.Password)
+	Equals(t, time.Hour, lease.Duration)
+	Assert(t, lease.Renewable, "Expected a renewable lease.")
+
+	Ok(t, sk.RenewLease(lease.LeaseId, time.Hour))
+	Equals(t, lease.LeaseId, renewed)
+
+	Ok(t, sk.RevokeLease(lease.LeaseId))
+	Equals(t, lease.LeaseId, revoked)
+
+	_, missingErr := sk.DBreadCreds("database", "absent")
+	Assert(t, missingErr != nil, "Expected an error from an absent role.")
+}
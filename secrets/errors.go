@@ -0,0 +1,110 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	openbao "github.com/openbao/openbao/api/v2"
+)
+
+// SECRETS_TIMEOUT bounds a single call to Openbao, including retries, unless
+// secrets.openbao.timeout says otherwise.
+const SECRETS_TIMEOUT = time.Second * 5
+
+// Kinds of failures reported by Openbao calls. Match them with errors.Is.
+var (
+	// ErrNotFound means the path holds no secret. Every Provider reports a
+	// missing secret with it.
+	ErrNotFound = errors.New("Secret not found.")
+	// ErrPermissionDenied means the token lacks a policy for the path, or
+	// the token is invalid.
+	ErrPermissionDenied = errors.New("Openbao permission denied.")
+	// ErrSealed means the Openbao server is sealed.
+	ErrSealed = errors.New("Openbao is sealed.")
+	// ErrTransport means Openbao could not be reached in time.
+	ErrTransport = errors.New("Openbao is unreachable.")
+	// ErrCodeUsed means the TOTP Engine already accepted the code during its
+	// period, i.e., the code was replayed.
+	ErrCodeUsed = errors.New("Openbao TOTP code already used.")
+)
+
+// Error describes a failed call to Openbao. Its Kind is one of the errors
+// above, or nil when the failure fits none of them.
+//
+//	if errors.Is(err, secrets.ErrNotFound) { ... }
+type Error struct {
+	// Op is the operation, e.g., read or write.
+	Op string
+	// Path is the Openbao path of the call.
+	Path string
+	// Kind classifies the failure.
+	Kind error
+	// Err is the original error.
+	Err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Openbao %v %v: %v", e.Op, e.Path, e.Err)
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Kind == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// wrapErr classifies the error of a call to Openbao.
+func wrapErr(op, path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Op: op, Path: path, Kind: errorKind(err), Err: err}
+}
+
+func errorKind(err error) error {
+	if errors.Is(err, openbao.ErrSecretNotFound) {
+		return ErrNotFound
+	}
+
+	var respErr *openbao.ResponseError
+	if errors.As(err, &respErr) {
+		message := strings.ToLower(strings.Join(respErr.Errors, " "))
+		switch respErr.StatusCode {
+		case 400:
+			if strings.Contains(message, "code already used") {
+				return ErrCodeUsed
+			}
+		case 404:
+			return ErrNotFound
+		case 401, 403:
+			return ErrPermissionDenied
+		case 503:
+			if strings.Contains(message, "sealed") {
+				return ErrSealed
+			}
+		}
+		return nil
+	}
+
+	var urlErr *url.Error
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &urlErr) || errors.As(err, &netErr) {
+		return ErrTransport
+	}
+	return nil
+}
+
+// callContext bounds a call to Openbao by the configured timeout.
+func (sk *SkeletonKey) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := SECRETS_TIMEOUT
+	if sk.settings != nil && sk.settings.Timeout > 0 {
+		timeout = time.Second * time.Duration(sk.settings.Timeout)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,71 @@
+package secrets_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/Shoowa/vamos/secrets"
+	. "github.com/Shoowa/vamos/testhelper"
+)
+
+func Test_TypedErrors(t *testing.T) {
+	var flaky atomic.Int32
+	openbao := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/secret/data/forbidden":
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+		case "/v1/totp/code/used":
+			http.Error(w, `{"errors":["code already used; wait until the next time period"]}`, http.StatusBadRequest)
+		case "/v1/transit/hash/sealed":
+			http.Error(w, `{"errors":["Vault is sealed"]}`, http.StatusServiceUnavailable)
+		case "/v1/transit/hash/flaky":
+			// Fail once, then succeed on the retry.
+			if flaky.Add(1) == 1 {
+				http.Error(w, `{"errors":["internal error"]}`, http.StatusBadGateway)
+				return
+			}
+			w.Write([]byte(`{"data":{"sum":"abc"}}`))
+		case "/v1/transit/hash/slow":
+			time.Sleep(time.Millisecond * 200)
+			w.Write([]byte(`{"data":{"sum":"abc"}}`))
+		default:
+			http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+		}
+	}
+	sk := fakeSkeletonKey(t, http.HandlerFunc(openbao))
+	hash := func(algo string) HashPayload {
+		data := sk.HashDraftPayload("input")
+		data.Algo = algo
+		return data
+	}
+
+	_, missingErr := sk.ReadPathAndKey("absent", "password")
+	Assert(t, errors.Is(missingErr, ErrNotFound), "Expected ErrNotFound, got %v", missingErr)
+
+	_, emptyErr := sk.LogicalRead("secret/absent")
+	Assert(t, errors.Is(emptyErr, ErrNotFound), "Expected ErrNotFound, got %v", emptyErr)
+
+	_, deniedErr := sk.ReadPathAndKey("forbidden", "password")
+	Assert(t, errors.Is(deniedErr, ErrPermissionDenied), "Expected ErrPermissionDenied, got %v", deniedErr)
+
+	_, sealedErr := sk.Hash(hash("sealed"))
+	Assert(t, errors.Is(sealedErr, ErrSealed), "Expected ErrSealed, got %v", sealedErr)
+
+	_, usedErr := sk.OTPverifyCode(sk.OTPdraftCode("used", "123456"))
+	Assert(t, errors.Is(usedErr, ErrCodeUsed), "Expected ErrCodeUsed, got %v", usedErr)
+
+	sum, flakyErr := sk.Hash(hash("flaky"))
+	Ok(t, flakyErr)
+	Equals(t, "abc", sum)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	_, slowErr := sk.HashContext(ctx, hash("slow"))
+	Assert(t, errors.Is(slowErr, ErrTransport), "Expected ErrTransport, got %v", slowErr)
+	Assert(t, errors.Is(slowErr, context.DeadlineExceeded), "Expected a deadline, got %v", slowErr)
+}
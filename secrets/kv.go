@@ -0,0 +1,163 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	openbao "github.com/openbao/openbao/api/v2"
+)
+
+// KV_MOUNT is the default mount of the KV engine, unless
+// secrets.openbao.kv_mount says otherwise.
+const KV_MOUNT = "secret"
+
+// kvMount substitutes the default mount for a blank one.
+func (sk *SkeletonKey) kvMount(mount string) string {
+	switch {
+	case mount != "":
+		return mount
+	case sk.settings != nil && sk.settings.KvMount != "":
+		return sk.settings.KvMount
+	default:
+		return KV_MOUNT
+	}
+}
+
+// kvV1 reports whether a mount holds a KV v1 engine.
+func (sk *SkeletonKey) kvV1(mount string) bool {
+	return sk.settings != nil && slices.Contains(sk.settings.KvV1Mounts, mount)
+}
+
+// getKv reads the latest version of a document from either KV engine.
+func (sk *SkeletonKey) getKv(ctx context.Context, mount, secretPath string) (*openbao.KVSecret, error) {
+	if sk.kvV1(mount) {
+		return sk.Openbao.KVv1(mount).Get(ctx, secretPath)
+	}
+	return sk.Openbao.KVv2(mount).Get(ctx, secretPath)
+}
+
+// KVread returns every field of a document. A blank mount reads the default
+// mount, and a version of zero reads the latest version. Only KV v2 keeps
+// older versions. The latest version is cached, see KV_CACHE_TTL.
+func (sk *SkeletonKey) KVread(ctx context.Context, mount, secretPath string, version int) (map[string]any, error) {
+	mount = sk.kvMount(mount)
+	if version == 0 {
+		return sk.readKv(ctx, mount, secretPath)
+	}
+	if sk.kvV1(mount) {
+		return nil, fmt.Errorf("KV v1 mount %v has no versions.", mount)
+	}
+
+	ctx, cancel := sk.callContext(ctx)
+	defer cancel()
+
+	secret, secretErr := sk.Openbao.KVv2(mount).GetVersion(ctx, secretPath, version)
+	if secretErr != nil {
+		return nil, wrapErr("read", mount+"/"+secretPath, secretErr)
+	}
+	return secret.Data, nil
+}
+
+// KVreadInto decodes every field of a document into a struct, respecting its
+// json tags.
+//
+//	var pg struct {
+//		User     string `json:"user"`
+//		Password string `json:"password"`
+//		Port     int    `json:"port"`
+//	}
+//	err := sk.KVreadInto(ctx, "", "dev-postgres-test", 0, &pg)
+func (sk *SkeletonKey) KVreadInto(ctx context.Context, mount, secretPath string, version int, dst any) error {
+	data, dataErr := sk.KVread(ctx, mount, secretPath, version)
+	if dataErr != nil {
+		return dataErr
+	}
+
+	doc, docErr := json.Marshal(data)
+	if docErr != nil {
+		return docErr
+	}
+	return json.Unmarshal(doc, dst)
+}
+
+// KVvalue returns a single field of the latest version of a document. The value
+// keeps its JSON type, i.e., a string, json.Number, bool, []any, or
+// map[string]any.
+func (sk *SkeletonKey) KVvalue(ctx context.Context, mount, secretPath, key string) (any, error) {
+	data, dataErr := sk.KVread(ctx, mount, secretPath, 0)
+	if dataErr != nil {
+		return nil, dataErr
+	}
+
+	v, found := data[key]
+	if !found {
+		return nil, fmt.Errorf("Field %v is absent from %v.", key, secretPath)
+	}
+	return v, nil
+}
+
+// KVstring returns a single string field of the latest version of a document.
+func (sk *SkeletonKey) KVstring(ctx context.Context, mount, secretPath, key string) (string, error) {
+	v, vErr := sk.KVvalue(ctx, mount, secretPath, key)
+	if vErr != nil {
+		return "", vErr
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return "", errors.New("Type assertion failed on the value.")
+	}
+	return s, nil
+}
+
+// KVwrite replaces a document, and returns its new version. A KV v1 engine
+// reports version zero.
+func (sk *SkeletonKey) KVwrite(ctx context.Context, mount, secretPath string, data map[string]any) (int, error) {
+	mount = sk.kvMount(mount)
+	defer sk.Forget(mount, secretPath)
+
+	ctx, cancel := sk.callContext(ctx)
+	defer cancel()
+
+	if sk.kvV1(mount) {
+		putErr := sk.Openbao.KVv1(mount).Put(ctx, secretPath, data)
+		return 0, wrapErr("write", mount+"/"+secretPath, putErr)
+	}
+
+	secret, putErr := sk.Openbao.KVv2(mount).Put(ctx, secretPath, data)
+	if putErr != nil {
+		return 0, wrapErr("write", mount+"/"+secretPath, putErr)
+	}
+	return secret.VersionMetadata.Version, nil
+}
+
+// KVpatch merges fields into a document, and returns its new version. A KV v1
+// engine lacks a patch operation, so the document is read, merged, and written.
+func (sk *SkeletonKey) KVpatch(ctx context.Context, mount, secretPath string, data map[string]any) (int, error) {
+	mount = sk.kvMount(mount)
+	if sk.kvV1(mount) {
+		sk.Forget(mount, secretPath)
+		current, readErr := sk.KVread(ctx, mount, secretPath, 0)
+		if readErr != nil {
+			return 0, readErr
+		}
+		merged := maps.Clone(current)
+		maps.Copy(merged, data)
+		return sk.KVwrite(ctx, mount, secretPath, merged)
+	}
+
+	defer sk.Forget(mount, secretPath)
+
+	ctx, cancel := sk.callContext(ctx)
+	defer cancel()
+
+	secret, patchErr := sk.Openbao.KVv2(mount).Patch(ctx, secretPath, data)
+	if patchErr != nil {
+		return 0, wrapErr("patch", mount+"/"+secretPath, patchErr)
+	}
+	return secret.VersionMetadata.Version, nil
+}
@@ -0,0 +1,109 @@
+package secrets_test
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"strings"
+	"testing"
+
+	. "github.com/Shoowa/vamos/secrets"
+	. "github.com/Shoowa/vamos/testhelper"
+)
+
+// fakeKv stands in for a KV v2 engine at the mount kv2, and a KV v1 engine at
+// the mount kv1. Each holds a single document named app.
+type fakeKv struct {
+	versions []map[string]any
+	v1       map[string]any
+}
+
+func (f *fakeKv) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body := map[string]any{}
+	json.NewDecoder(r.Body).Decode(&body)
+	w.Header().Set("Content-Type", "application/json")
+	reply := func(data any) { json.NewEncoder(w).Encode(map[string]any{"data": data}) }
+
+	switch {
+	case r.URL.Path == "/v1/kv2/data/app" && r.Method == http.MethodGet:
+		version := len(f.versions)
+		if v := r.URL.Query().Get("version"); v != "" {
+			json.Unmarshal([]byte(v), &version)
+		}
+		meta := map[string]any{"version": version}
+		reply(map[string]any{"data": f.versions[version-1], "metadata": meta})
+	case r.URL.Path == "/v1/kv2/data/app":
+		data, _ := body["data"].(map[string]any)
+		if r.Method == http.MethodPatch {
+			data = maps.Clone(f.versions[len(f.versions)-1])
+			maps.Copy(data, body["data"].(map[string]any))
+		}
+		f.versions = append(f.versions, data)
+		reply(map[string]any{"version": len(f.versions)})
+	case r.URL.Path == "/v1/kv2/metadata/app":
+		reply(map[string]any{"current_version": len(f.versions)})
+	case r.URL.Path == "/v1/kv1/app" && r.Method == http.MethodGet:
+		reply(f.v1)
+	case r.URL.Path == "/v1/kv1/app":
+		f.v1 = body
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+	}
+}
+
+func Test_KV(t *testing.T) {
+	t.Setenv("OPENBAO_TOKEN", "token")
+	kv := &fakeKv{
+		versions: []map[string]any{{"user": "app", "password": "old", "port": 5432, "tls": true}},
+		v1:       map[string]any{"user": "legacy", "password": "v1"},
+	}
+	cfg := fakeConfig(t, kv)
+	cfg.Secrets.Openbao.KvMount = "kv2"
+	cfg.Secrets.Openbao.KvV1Mounts = []string{"kv1"}
+	sk := new(SkeletonKey)
+	sk.Create(cfg)
+	ctx := t.Context()
+
+	var pg struct {
+		User     string `json:"user"`
+		Password string `json:"password"`
+		Port     int    `json:"port"`
+		Tls      bool   `json:"tls"`
+	}
+	Ok(t, sk.KVreadInto(ctx, "", "app", 0, &pg))
+	Equals(t, 5432, pg.Port)
+	Assert(t, pg.Tls, "Expected a bool read from the secret.")
+
+	tls, tlsErr := sk.KVvalue(ctx, "", "app", "tls")
+	Ok(t, tlsErr)
+	Equals(t, true, tls)
+
+	version, patchErr := sk.KVpatch(ctx, "", "app", map[string]any{"password": "new"})
+	Ok(t, patchErr)
+	Equals(t, 2, version)
+
+	// A write forgets the cached document.
+	latest, latestErr := sk.ReadPathAndKey("app", "password")
+	Ok(t, latestErr)
+	Equals(t, "new", latest)
+
+	first, firstErr := sk.KVread(ctx, "kv2", "app", 1)
+	Ok(t, firstErr)
+	Equals(t, "old", first["password"])
+
+	resolved, resolveErr := sk.Resolvers().Resolve("bao://kv2/app?version=1#password")
+	Ok(t, resolveErr)
+	Equals(t, "old", resolved)
+
+	legacy, legacyErr := sk.KVstring(ctx, "kv1", "app", "password")
+	Ok(t, legacyErr)
+	Equals(t, "v1", legacy)
+
+	_, v1PatchErr := sk.KVpatch(ctx, "kv1", "app", map[string]any{"password": "v1-new"})
+	Ok(t, v1PatchErr)
+	Equals(t, map[string]any{"user": "legacy", "password": "v1-new"}, kv.v1)
+
+	_, versionErr := sk.KVread(ctx, "kv1", "app", 2)
+	Assert(t, versionErr != nil && strings.Contains(versionErr.Error(), "no versions"), "Expected an error from a versioned KV v1 read.")
+}
@@ -0,0 +1,214 @@
+package secrets
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const PKI_MOUNT = "pki"
+
+// CertRequest describes a leaf certificate requested from the Openbao PKI
+// engine. The PKI engine must be enabled on the Openbao server, and the Role
+// must permit the requested names.
+type CertRequest struct {
+	// Mount is where the PKI engine is enabled. Defaults to PKI_MOUNT.
+	Mount string
+	// Role names the PKI role, and is part of the URL path.
+	Role string
+	// CommonName is the CN of the certificate subject.
+	CommonName string
+	// AltNames are DNS or email subject alternative names.
+	AltNames []string
+	// IpSans are IP subject alternative names.
+	IpSans []string
+	// Ttl is the requested lifetime, e.g., 72h. When blank, the Role decides.
+	Ttl string
+}
+
+func (req CertRequest) mount() string {
+	if req.Mount == "" {
+		return PKI_MOUNT
+	}
+	return req.Mount
+}
+
+// PKIissueCert asks the PKI engine to generate a key and issue a certificate
+// for a role. The key is created by Openbao, and travels in the response.
+func (sk *SkeletonKey) PKIissueCert(req CertRequest) (*tls.Certificate, error) {
+	return sk.PKIissueCertContext(context.Background(), req)
+}
+
+// PKIissueCertContext is PKIissueCert bounded by a context.
+func (sk *SkeletonKey) PKIissueCertContext(ctx context.Context, req CertRequest) (*tls.Certificate, error) {
+	fullPath := req.mount() + "/issue/" + req.Role
+	info := payload{
+		"common_name": req.CommonName,
+		"alt_names":   strings.Join(req.AltNames, ","),
+		"ip_sans":     strings.Join(req.IpSans, ","),
+		"ttl":         req.Ttl,
+	}
+
+	secret, secretErr := sk.LogicalWriteContext(ctx, fullPath, info)
+	if secretErr != nil {
+		return nil, secretErr
+	}
+	if secret == nil {
+		return nil, errors.New("Openbao PKI engine returned no certificate.")
+	}
+
+	key, ok := secret.Data["private_key"].(string)
+	if !ok {
+		return nil, errors.New("Type assertion failed on the field PRIVATE_KEY.")
+	}
+
+	return assembleChain(secret.Data, []byte(key))
+}
+
+// PKIsignCSR generates a ECDSA P-256 key locally, and asks the PKI engine to
+// sign a CSR for a role. The private key never leaves the process.
+func (sk *SkeletonKey) PKIsignCSR(req CertRequest) (*tls.Certificate, error) {
+	return sk.PKIsignCSRContext(context.Background(), req)
+}
+
+// PKIsignCSRContext is PKIsignCSR bounded by a context.
+func (sk *SkeletonKey) PKIsignCSRContext(ctx context.Context, req CertRequest) (*tls.Certificate, error) {
+	key, keyErr := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if keyErr != nil {
+		return nil, keyErr
+	}
+
+	template := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: req.CommonName},
+		DNSNames: req.AltNames,
+	}
+	csr, csrErr := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if csrErr != nil {
+		return nil, csrErr
+	}
+
+	fullPath := req.mount() + "/sign/" + req.Role
+	info := payload{
+		"csr":         string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})),
+		"common_name": req.CommonName,
+		"alt_names":   strings.Join(req.AltNames, ","),
+		"ip_sans":     strings.Join(req.IpSans, ","),
+		"ttl":         req.Ttl,
+	}
+
+	secret, secretErr := sk.LogicalWriteContext(ctx, fullPath, info)
+	if secretErr != nil {
+		return nil, secretErr
+	}
+	if secret == nil {
+		return nil, errors.New("Openbao PKI engine returned no certificate.")
+	}
+
+	keyDer, keyDerErr := x509.MarshalPKCS8PrivateKey(key)
+	if keyDerErr != nil {
+		return nil, keyDerErr
+	}
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer})
+
+	return assembleChain(secret.Data, keyPem)
+}
+
+// assembleChain pairs the issued certificate with its key, and presents the
+// issuing CA after the leaf certificate.
+func assembleChain(data map[string]any, key []byte) (*tls.Certificate, error) {
+	cert, ok := data["certificate"].(string)
+	if !ok {
+		return nil, errors.New("Type assertion failed on the field CERTIFICATE.")
+	}
+
+	chain := cert
+	if issuer, ok := data["issuing_ca"].(string); ok {
+		chain += "\n" + issuer
+	}
+
+	pair, X509Err := tls.X509KeyPair([]byte(chain), key)
+	if X509Err != nil {
+		return nil, X509Err
+	}
+	return &pair, nil
+}
+
+// PKIreadCaChain reads the CA chain of the PKI engine, and returns a pool that
+// can verify the certificates it issues.
+func (sk *SkeletonKey) PKIreadCaChain(mount string) (*x509.CertPool, error) {
+	return sk.PKIreadCaChainContext(context.Background(), mount)
+}
+
+// PKIreadCaChainContext is PKIreadCaChain bounded by a context.
+func (sk *SkeletonKey) PKIreadCaChainContext(ctx context.Context, mount string) (*x509.CertPool, error) {
+	if mount == "" {
+		mount = PKI_MOUNT
+	}
+	chain, chainErr := sk.readPkiCaChain(ctx, mount)
+	if chainErr != nil {
+		return nil, chainErr
+	}
+	return certPool(chain)
+}
+
+// readPkiCaChain reads the CA chain of the Openbao PKI engine as PEM bytes.
+func (sk *SkeletonKey) readPkiCaChain(ctx context.Context, mount string) ([]byte, error) {
+	secret, secretErr := sk.LogicalReadContext(ctx, mount+"/cert/ca_chain")
+	if secretErr != nil {
+		return nil, secretErr
+	}
+	if secret == nil {
+		return nil, errors.New("Openbao PKI engine returned no CA chain.")
+	}
+
+	chain, ok := secret.Data["certificate"].(string)
+	if !ok {
+		return nil, errors.New("Type assertion failed on the field CERTIFICATE.")
+	}
+	return []byte(chain), nil
+}
+
+// PKIrevokeCert revokes a certificate issued by the PKI engine. The serial is
+// formatted like Openbao formats it, e.g., 39:dd:2e:..., see PKIserial.
+func (sk *SkeletonKey) PKIrevokeCert(mount, serial string) error {
+	return sk.PKIrevokeCertContext(context.Background(), mount, serial)
+}
+
+// PKIrevokeCertContext is PKIrevokeCert bounded by a context.
+func (sk *SkeletonKey) PKIrevokeCertContext(ctx context.Context, mount, serial string) error {
+	if mount == "" {
+		mount = PKI_MOUNT
+	}
+	info := payload{
+		"serial_number": serial,
+	}
+
+	_, writeErr := sk.LogicalWriteContext(ctx, mount+"/revoke", info)
+	if writeErr != nil {
+		return writeErr
+	}
+	return nil
+}
+
+// PKIserial formats the serial number of a certificate like Openbao does,
+// i.e., colon separated pairs of lowercase hex digits.
+func PKIserial(cert *x509.Certificate) string {
+	hex := fmt.Sprintf("%x", cert.SerialNumber)
+	if len(hex)%2 == 1 {
+		hex = "0" + hex
+	}
+
+	pairs := make([]string, 0, len(hex)/2)
+	for i := 0; i < len(hex); i += 2 {
+		pairs = append(pairs, hex[i:i+2])
+	}
+	return strings.Join(pairs, ":")
+}
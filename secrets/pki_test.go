@@ -0,0 +1,143 @@
+package secrets_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	openbao "github.com/openbao/openbao/api/v2"
+
+	. "github.com/Shoowa/vamos/secrets"
+	. "github.com/Shoowa/vamos/testhelper"
+)
+
+// fakePki stands in for the PKI engine of an Openbao server. It signs leaf
+// certificates with a self-signed CA.
+type fakePki struct {
+	caPem   []byte
+	ca      *x509.Certificate
+	caKey   any
+	serial  int64
+	revoked []string
+}
+
+func newFakePki(t *testing.T) *fakePki {
+	caPem, caKeyPem := selfSigned(t, "Fake PKI CA")
+	caBlock, _ := pem.Decode(caPem)
+	ca, caErr := x509.ParseCertificate(caBlock.Bytes)
+	Ok(t, caErr)
+	keyBlock, _ := pem.Decode(caKeyPem)
+	caKey, keyErr := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	Ok(t, keyErr)
+	return &fakePki{caPem: caPem, ca: ca, caKey: caKey, serial: 0x3a0f}
+}
+
+func (f *fakePki) sign(cn string, pub any) string {
+	f.serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(f.serial),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, f.ca, pub, f.caKey)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func (f *fakePki) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body := map[string]any{}
+	json.NewDecoder(r.Body).Decode(&body)
+	cn, _ := body["common_name"].(string)
+
+	data := map[string]any{}
+	switch r.URL.Path {
+	case "/v1/pki/issue/web":
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		keyDer, _ := x509.MarshalPKCS8PrivateKey(key)
+		data["certificate"] = f.sign(cn, &key.PublicKey)
+		data["issuing_ca"] = string(f.caPem)
+		data["private_key"] = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}))
+	case "/v1/pki/sign/web":
+		csrPem, _ := body["csr"].(string)
+		block, _ := pem.Decode([]byte(csrPem))
+		csr, csrErr := x509.ParseCertificateRequest(block.Bytes)
+		if csrErr != nil {
+			http.Error(w, `{"errors":["bad csr"]}`, http.StatusBadRequest)
+			return
+		}
+		data["certificate"] = f.sign(cn, csr.PublicKey)
+		data["issuing_ca"] = string(f.caPem)
+	case "/v1/pki/cert/ca_chain":
+		data["certificate"] = string(f.caPem)
+	case "/v1/pki/revoke":
+		serial, _ := body["serial_number"].(string)
+		f.revoked = append(f.revoked, serial)
+		data["revocation_time"] = time.Now().Unix()
+	default:
+		http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"data": data})
+}
+
+func fakeSkeletonKey(t *testing.T, h http.Handler) *SkeletonKey {
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	obCfg := openbao.DefaultConfig()
+	obCfg.Address = srv.URL
+	obCfg.MinRetryWait = time.Millisecond
+	obCfg.MaxRetryWait = time.Millisecond * 10
+	client, clientErr := openbao.NewClient(obCfg)
+	Ok(t, clientErr)
+	client.SetToken("token")
+	return &SkeletonKey{Openbao: client}
+}
+
+func Test_PKI(t *testing.T) {
+	pki := newFakePki(t)
+	sk := fakeSkeletonKey(t, pki)
+	req := CertRequest{Role: "web", CommonName: "app.internal", Ttl: "1h"}
+
+	pool, poolErr := sk.PKIreadCaChain("")
+	Ok(t, poolErr)
+
+	verify := func(cert *tls.Certificate) {
+		Equals(t, 2, len(cert.Certificate))
+		Equals(t, "app.internal", cert.Leaf.Subject.CommonName)
+		_, verifyErr := cert.Leaf.Verify(x509.VerifyOptions{Roots: pool, DNSName: "app.internal"})
+		Ok(t, verifyErr)
+	}
+
+	issued, issueErr := sk.PKIissueCert(req)
+	Ok(t, issueErr)
+	verify(issued)
+
+	signed, signErr := sk.PKIsignCSR(req)
+	Ok(t, signErr)
+	verify(signed)
+
+	serial := PKIserial(signed.Leaf)
+	Assert(t, strings.Count(serial, ":") == 1, "Serial lacks colon separated pairs: "+serial)
+	Ok(t, sk.PKIrevokeCert("", serial))
+	Equals(t, []string{serial}, pki.revoked)
+
+	_, missingErr := sk.PKIissueCert(CertRequest{Role: "absent", CommonName: "app.internal"})
+	Assert(t, missingErr != nil, "Expected an error from an absent role.")
+}
@@ -0,0 +1,240 @@
+package secrets
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Shoowa/vamos/config"
+)
+
+// Provider is the part of secret storage used by the rdbms, cache, and server
+// packages. The SkeletonKey provides secrets from Openbao, while the
+// DirProvider, EnvProvider, and MemoryProvider let an application run locally,
+// or in tests, without Openbao.
+//
+// A TlsSecret with the openbao_kv source is read with ReadKey, whichever the
+// Provider. Only the SkeletonKey supports the openbao_pki source.
+type Provider interface {
+	// ReadKey reads the value of a key in a secret. A blank mount means the
+	// default of the Provider.
+	ReadKey(ctx context.Context, mount, secretPath, key string) (string, error)
+	// ReadTlsCertAndKey assembles the certificate & key of a TlsSecret.
+	ReadTlsCertAndKey(tlsInfo *config.TlsSecret) (*tls.Certificate, error)
+	// ReadCA reads the CA of a TlsSecret as PEM bytes, or nil.
+	ReadCA(tlsInfo *config.TlsSecret) ([]byte, error)
+}
+
+// NewProvider creates the Provider declared in secrets.provider. The Openbao
+// provider logs in before it is returned.
+func NewProvider(cfg *config.Config) (Provider, error) {
+	switch cfg.Secrets.Provider {
+	case config.PROVIDER_OPENBAO, "":
+		sk := new(SkeletonKey)
+		createErr := sk.create(cfg)
+		if createErr != nil {
+			return nil, createErr
+		}
+		return sk, nil
+	case config.PROVIDER_DIR:
+		return NewDirProvider(cfg.Secrets.Dir), nil
+	case config.PROVIDER_ENV:
+		return NewEnvProvider(cfg.Secrets.EnvPrefix), nil
+	default:
+		return nil, fmt.Errorf("Unknown secrets provider %q.", cfg.Secrets.Provider)
+	}
+}
+
+// ReadKey reads a string value from the KV engine. It fulfills the Provider
+// interface with KVstring.
+func (sk *SkeletonKey) ReadKey(ctx context.Context, mount, secretPath, key string) (string, error) {
+	return sk.KVstring(ctx, mount, secretPath, key)
+}
+
+// IntermediateCA reads the intermediate CA of a HttpServer through any
+// Provider. When SecretCA is blank, then the CA of the TlsClient source is
+// read instead.
+func IntermediateCA(p Provider, cfg *config.HttpServer) ([]byte, error) {
+	if cfg.SecretCA == "" {
+		return p.ReadCA(cfg.TlsClient)
+	}
+
+	ca, caErr := p.ReadKey(context.Background(), "", cfg.SecretCA, cfg.SecretCAKey)
+	if caErr != nil {
+		return nil, caErr
+	}
+
+	return decodePem(ca)
+}
+
+// CertPool creates a pool holding the intermediate CA of a HttpServer.
+func CertPool(p Provider, cfg *config.HttpServer) (*x509.CertPool, error) {
+	ca, caErr := IntermediateCA(p, cfg)
+	if caErr != nil {
+		return nil, caErr
+	}
+
+	return certPool(ca)
+}
+
+// ClientTLS assembles a tls.Config with the client cert, the intermediate CA,
+// and TLS 1.3 for connections to other services, e.g., Postgres & Redis.
+func ClientTLS(p Provider, cfg *config.HttpServer) (*tls.Config, error) {
+	clientCert, ccErr := p.ReadTlsCertAndKey(cfg.TlsClient)
+	if ccErr != nil {
+		return nil, ccErr
+	}
+
+	certPool, cpErr := CertPool(p, cfg)
+	if cpErr != nil {
+		return nil, cpErr
+	}
+
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS13,
+		Certificates: []tls.Certificate{*clientCert},
+		RootCAs:      certPool,
+	}, nil
+}
+
+func notFound(id string) error {
+	return fmt.Errorf("Secret %v lacks a value: %w", id, ErrNotFound)
+}
+
+// DirProvider reads a file per key, at <Root>/<mount>/<path>/<key>. Kubernetes
+// mounts a secret as such a directory, so a secret named postgres with a key
+// named password is read from <Root>/postgres/password when the mount is
+// blank. A trailing newline is trimmed from every value.
+type DirProvider struct {
+	Root string
+}
+
+// NewDirProvider creates a DirProvider that reads below root.
+func NewDirProvider(root string) *DirProvider {
+	return &DirProvider{Root: root}
+}
+
+// ReadKey reads the file of a key. The file must stay below Root.
+func (d *DirProvider) ReadKey(ctx context.Context, mount, secretPath, key string) (string, error) {
+	rel := filepath.Join(mount, secretPath, key)
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("Secret %v escapes the directory of secrets.", rel)
+	}
+
+	value, readErr := os.ReadFile(filepath.Join(d.Root, rel))
+	if errors.Is(readErr, os.ErrNotExist) {
+		return "", notFound(rel)
+	}
+	if readErr != nil {
+		return "", readErr
+	}
+
+	return strings.TrimRight(string(value), "\r\n"), nil
+}
+
+func (d *DirProvider) ReadTlsCertAndKey(tlsInfo *config.TlsSecret) (*tls.Certificate, error) {
+	return readTlsCertAndKey(d, tlsInfo)
+}
+
+func (d *DirProvider) ReadCA(tlsInfo *config.TlsSecret) ([]byte, error) {
+	return readCA(d, tlsInfo)
+}
+
+// EnvProvider reads environ variables. The name of a variable is the Prefix,
+// followed by the mount, path, and key in upper case, joined by underscores.
+// Every other character is replaced by an underscore. So the key password of
+// the secret dev-postgres-test is read from DEV_POSTGRES_TEST_PASSWORD, or from
+// APP_DEV_POSTGRES_TEST_PASSWORD with the prefix APP_.
+type EnvProvider struct {
+	Prefix string
+}
+
+// NewEnvProvider creates an EnvProvider that reads variables beginning with
+// prefix.
+func NewEnvProvider(prefix string) *EnvProvider {
+	return &EnvProvider{Prefix: prefix}
+}
+
+// EnvName names the environ variable holding a key.
+func (e *EnvProvider) EnvName(mount, secretPath, key string) string {
+	parts := []string{}
+	for _, part := range []string{mount, secretPath, key} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	name := strings.ToUpper(strings.Join(parts, "_"))
+	name = strings.Map(func(r rune) rune {
+		if ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+	return e.Prefix + name
+}
+
+func (e *EnvProvider) ReadKey(ctx context.Context, mount, secretPath, key string) (string, error) {
+	name := e.EnvName(mount, secretPath, key)
+	value, found := os.LookupEnv(name)
+	if !found {
+		return "", notFound(name)
+	}
+	return value, nil
+}
+
+func (e *EnvProvider) ReadTlsCertAndKey(tlsInfo *config.TlsSecret) (*tls.Certificate, error) {
+	return readTlsCertAndKey(e, tlsInfo)
+}
+
+func (e *EnvProvider) ReadCA(tlsInfo *config.TlsSecret) ([]byte, error) {
+	return readCA(e, tlsInfo)
+}
+
+// MemoryProvider holds secrets in memory. It suits tests.
+type MemoryProvider struct {
+	mu     sync.RWMutex
+	values map[string]string
+}
+
+// NewMemoryProvider creates an empty MemoryProvider.
+func NewMemoryProvider() *MemoryProvider {
+	return &MemoryProvider{values: map[string]string{}}
+}
+
+func memoryId(mount, secretPath, key string) string {
+	return mount + "/" + secretPath + "#" + key
+}
+
+// Set stores the value of a key, replacing any previous value.
+func (m *MemoryProvider) Set(mount, secretPath, key, value string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[memoryId(mount, secretPath, key)] = value
+}
+
+func (m *MemoryProvider) ReadKey(ctx context.Context, mount, secretPath, key string) (string, error) {
+	id := memoryId(mount, secretPath, key)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	value, found := m.values[id]
+	if !found {
+		return "", notFound(id)
+	}
+	return value, nil
+}
+
+func (m *MemoryProvider) ReadTlsCertAndKey(tlsInfo *config.TlsSecret) (*tls.Certificate, error) {
+	return readTlsCertAndKey(m, tlsInfo)
+}
+
+func (m *MemoryProvider) ReadCA(tlsInfo *config.TlsSecret) ([]byte, error) {
+	return readCA(m, tlsInfo)
+}
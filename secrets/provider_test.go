@@ -0,0 +1,112 @@
+package secrets_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Shoowa/vamos/config"
+	. "github.com/Shoowa/vamos/secrets"
+	. "github.com/Shoowa/vamos/testhelper"
+)
+
+// keyedTls declares a certificate, key, & CA stored as keys of a secret named
+// app-tls, in the layout of a Kubernetes TLS secret.
+func keyedTls() *config.HttpServer {
+	return &config.HttpServer{
+		TlsClient: &config.TlsSecret{
+			Source:    config.TLS_OPENBAO_KV,
+			CaPath:    "app-tls",
+			CaField:   "ca.crt",
+			CertPath:  "app-tls",
+			CertField: "tls.crt",
+			KeyPath:   "app-tls",
+			KeyField:  "tls.key",
+		},
+	}
+}
+
+func Test_DirProvider(t *testing.T) {
+	certPem, keyPem := selfSigned(t, "localhost")
+	root := t.TempDir()
+	Ok(t, os.MkdirAll(filepath.Join(root, "postgres"), 0o700))
+	Ok(t, os.MkdirAll(filepath.Join(root, "app-tls"), 0o700))
+	Ok(t, os.WriteFile(filepath.Join(root, "postgres", "password"), []byte("hunter2\n"), 0o600))
+	Ok(t, os.WriteFile(filepath.Join(root, "app-tls", "tls.crt"), certPem, 0o600))
+	Ok(t, os.WriteFile(filepath.Join(root, "app-tls", "tls.key"), keyPem, 0o600))
+	Ok(t, os.WriteFile(filepath.Join(root, "app-tls", "ca.crt"), certPem, 0o600))
+
+	var p Provider = NewDirProvider(root)
+	ctx := context.Background()
+
+	pw, pwErr := p.ReadKey(ctx, "", "postgres", "password")
+	Ok(t, pwErr)
+	Equals(t, "hunter2", pw)
+
+	_, missingErr := p.ReadKey(ctx, "", "postgres", "user")
+	Assert(t, errors.Is(missingErr, ErrNotFound), "Expected ErrNotFound, got %v", missingErr)
+
+	_, escapeErr := p.ReadKey(ctx, "..", "postgres", "password")
+	Assert(t, escapeErr != nil, "Expected an error for a path outside the root.")
+
+	tlsConfig, tlsErr := ClientTLS(p, keyedTls())
+	Ok(t, tlsErr)
+	Equals(t, 1, len(tlsConfig.Certificates))
+	Assert(t, tlsConfig.RootCAs != nil, "Lacks a CA pool from the directory.")
+
+	_, pkiErr := p.ReadTlsCertAndKey(&config.TlsSecret{Source: config.TLS_OPENBAO_PKI})
+	Assert(t, pkiErr != nil, "Expected an error for the PKI source without Openbao.")
+}
+
+func Test_EnvProvider(t *testing.T) {
+	p := NewEnvProvider("APP_")
+	Equals(t, "APP_DEV_POSTGRES_TEST_PASSWORD", p.EnvName("", "dev-postgres-test", "password"))
+	Equals(t, "APP_SECRET_REDIS_PASSWORD", p.EnvName("secret", "redis", "password"))
+
+	t.Setenv("APP_DEV_POSTGRES_TEST_PASSWORD", "hunter2")
+	pw, pwErr := p.ReadKey(context.Background(), "", "dev-postgres-test", "password")
+	Ok(t, pwErr)
+	Equals(t, "hunter2", pw)
+
+	_, missingErr := p.ReadKey(context.Background(), "", "dev-postgres-test", "user")
+	Assert(t, errors.Is(missingErr, ErrNotFound), "Expected ErrNotFound, got %v", missingErr)
+}
+
+func Test_MemoryProvider(t *testing.T) {
+	certPem, keyPem := selfSigned(t, "localhost")
+	p := NewMemoryProvider()
+	p.Set("", "app-tls", "tls.crt", string(certPem))
+	p.Set("", "app-tls", "tls.key", string(keyPem))
+	p.Set("", "app-tls", "ca.crt", string(certPem))
+
+	pool, poolErr := CertPool(p, keyedTls())
+	Ok(t, poolErr)
+	Assert(t, pool != nil, "Lacks a CA pool from memory.")
+
+	cert, certErr := p.ReadTlsCertAndKey(keyedTls().TlsClient)
+	Ok(t, certErr)
+	Equals(t, 1, len(cert.Certificate))
+
+	_, missingErr := p.ReadKey(context.Background(), "", "postgres", "password")
+	Assert(t, errors.Is(missingErr, ErrNotFound), "Expected ErrNotFound, got %v", missingErr)
+}
+
+func Test_NewProvider(t *testing.T) {
+	cfg := &config.Config{Secrets: &config.Secrets{Provider: config.PROVIDER_DIR, Dir: t.TempDir()}}
+	dir, dirErr := NewProvider(cfg)
+	Ok(t, dirErr)
+	_, isDir := dir.(*DirProvider)
+	Assert(t, isDir, "Expected a DirProvider, got %T", dir)
+
+	cfg.Secrets.Provider = config.PROVIDER_ENV
+	env, envErr := NewProvider(cfg)
+	Ok(t, envErr)
+	_, isEnv := env.(*EnvProvider)
+	Assert(t, isEnv, "Expected an EnvProvider, got %T", env)
+
+	cfg.Secrets.Provider = "vault"
+	_, unknownErr := NewProvider(cfg)
+	Assert(t, unknownErr != nil, "Expected an error for an unknown provider.")
+}
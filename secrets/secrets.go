@@ -6,6 +6,11 @@ import (
 	"crypto/x509"
 	"encoding/base64"
 	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
 
 	openbao "github.com/openbao/openbao/api/v2"
 
@@ -16,151 +21,190 @@ import (
 // clients that read different storage.
 type SkeletonKey struct {
 	Openbao *openbao.Client
+
+	settings   *config.Openbao
+	authSecret *openbao.Secret
+	authFailed atomic.Bool
+	kv         kvCache
+	watch      secretWatch
 }
 
 // Create is a method of the SkeletonKey. It is hardcoded for the Openbao
 // client. It basically adds a token to an Openbao client, and adds the client
-// to the SkeletonKey.
+// to the SkeletonKey. The token is obtained with the method declared in
+// secrets.openbao.auth, which defaults to reading OPENBAO_TOKEN.
 func (sk *SkeletonKey) Create(cfg *config.Config) {
-	cfg.Secrets.Openbao.ReadToken()
-	clientConfig := readConfig(cfg)
-	client, err := buildClient(clientConfig, cfg.Secrets.Openbao.Token)
+	createErr := sk.create(cfg)
+	if createErr != nil {
+		panic(createErr.Error())
+	}
+}
+
+func (sk *SkeletonKey) create(cfg *config.Config) error {
+	clientConfig, cfgErr := readConfig(cfg)
+	if cfgErr != nil {
+		return cfgErr
+	}
+	client, err := buildClient(clientConfig)
 	if err != nil {
-		panic(err.Error())
+		return err
 	}
 	sk.Openbao = client
+	sk.settings = &cfg.Secrets.Openbao
+
+	return sk.Login()
 }
 
-func readConfig(cfg *config.Config) *openbao.Config {
+func readConfig(cfg *config.Config) (*openbao.Config, error) {
 	url := cfg.Secrets.Openbao.ReadConfig()
 	clientConfig := openbao.DefaultConfig()
 	clientConfig.Address = url
 
-	// If the config file possesses an entry for a X509 certificate in the OpenBao
-	// portion, then configure the OpenBao client for TLS.
-	if cfg.Secrets.Openbao.TlsClient.CertPath != "" {
+	// The client retries 5xx responses & connection errors with backoff.
+	switch retries := cfg.Secrets.Openbao.MaxRetries; {
+	case retries < 0:
+		clientConfig.MaxRetries = 0
+	case retries > 0:
+		clientConfig.MaxRetries = retries
+	}
+
+	// The Openbao client can only read local files or inline PEM values to
+	// build a TLS connection to the Openbao server.
+	tlsInfo := cfg.Secrets.Openbao.TlsClient
+	switch tlsInfo.Source {
+	case config.TLS_FILE:
+		// If the config file possesses an entry for a X509 certificate in the
+		// OpenBao portion, then configure the OpenBao client for TLS.
+		if tlsInfo.CertPath == "" && tlsInfo.CaPath == "" {
+			return clientConfig, nil
+		}
 		tls := openbao.TLSConfig{}
-		tls.ClientCert = cfg.Secrets.Openbao.TlsClient.CertPath
-		tls.ClientKey = cfg.Secrets.Openbao.TlsClient.KeyPath
-		tls.CACert = cfg.Secrets.Openbao.TlsClient.CaPath
+		tls.ClientCert = tlsInfo.CertPath
+		tls.ClientKey = tlsInfo.KeyPath
+		tls.CACert = tlsInfo.CaPath
 		tls.Insecure = false
 		clientConfig.ConfigureTLS(&tls)
-	}
-	return clientConfig
+	case config.TLS_INLINE:
+		if tlsInfo.CertPem == "" && tlsInfo.CaPem == "" {
+			return clientConfig, nil
+		}
+		reader := new(SkeletonKey)
+		tlsConfig, tlsErr := reader.ConfigureTLS(tlsInfo)
+		if tlsErr != nil {
+			return nil, tlsErr
+		}
+		transport, ok := clientConfig.HttpClient.Transport.(*http.Transport)
+		if !ok {
+			return nil, errors.New("Openbao client lacks a configurable transport.")
+		}
+		transport.TLSClientConfig = tlsConfig
+	default:
+		return nil, fmt.Errorf("Openbao client can't read TLS source %q.", tlsInfo.Source)
+	}
+	return clientConfig, nil
 }
 
-func buildClient(obCfg *openbao.Config, token string) (*openbao.Client, error) {
+func buildClient(obCfg *openbao.Config) (*openbao.Client, error) {
 	client, err := openbao.NewClient(obCfg)
 	if err != nil {
 		return nil, err
 	}
-
-	client.SetToken(token)
 	return client, nil
 }
 
-// ReadPathAndKey expects an Openbao endpoint, and a JSON key.
+// ReadPathAndKey expects an Openbao endpoint in the default KV mount, and a
+// JSON key. Values are cached for a short while, see KV_CACHE_TTL.
 func (sk *SkeletonKey) ReadPathAndKey(secretPath, key string) (string, error) {
-	secret, secretErr := sk.Openbao.KVv2("secret").Get(context.Background(), secretPath)
-	if secretErr != nil {
-		return "", secretErr
-	}
+	return sk.ReadPathAndKeyContext(context.Background(), secretPath, key)
+}
 
-	v, ok := secret.Data[key].(string)
-	if !ok {
-		return "", errors.New("Type assertion failed on the value.")
-	}
-	return v, nil
+// ReadPathAndKeyContext is ReadPathAndKey bounded by a context, and by the
+// configured timeout.
+func (sk *SkeletonKey) ReadPathAndKeyContext(ctx context.Context, secretPath, key string) (string, error) {
+	return sk.KVstring(ctx, "", secretPath, key)
 }
 
-// ReadTlsCertAndKey expects a custom struct named TlsSecret in the Config file.
-// It will assemble a x509 certificate and key that is stored in Openbao as a
-// base64 values.
-func (sk *SkeletonKey) ReadTlsCertAndKey(tlsInfo *config.TlsSecret) (*tls.Certificate, error) {
-	cert64, certErr := sk.ReadPathAndKey(tlsInfo.CertPath, tlsInfo.CertField)
-	if certErr != nil {
-		return nil, certErr
+// Resolve reads a bao:// reference from a KV engine. The first segment of the
+// path names the mount, e.g., bao://secret/dev-postgres-test#password, and an
+// optional version can be requested, e.g., ?version=3
+func (sk *SkeletonKey) Resolve(ref config.Reference) (string, error) {
+	mount, secretPath, found := strings.Cut(ref.Path, "/")
+	if !found || ref.Key == "" {
+		return "", fmt.Errorf("Openbao reference %v needs a mount, a path, and a key.", ref)
 	}
 
-	key64, keyErr := sk.ReadPathAndKey(tlsInfo.KeyPath, tlsInfo.KeyField)
-	if keyErr != nil {
-		return nil, keyErr
+	version := 0
+	if v := ref.Query.Get("version"); v != "" {
+		parsed, parseErr := strconv.Atoi(v)
+		if parseErr != nil {
+			return "", fmt.Errorf("Openbao reference %v has an invalid version.", ref)
+		}
+		version = parsed
 	}
 
-	cert, decodeCertErr := base64.StdEncoding.DecodeString(cert64)
-	if decodeCertErr != nil {
-		return nil, decodeCertErr
+	data, dataErr := sk.KVread(context.Background(), mount, secretPath, version)
+	if dataErr != nil {
+		return "", dataErr
 	}
-
-	key, decodeKeyErr := base64.StdEncoding.DecodeString(key64)
-	if decodeKeyErr != nil {
-		return nil, decodeKeyErr
+	v, ok := data[ref.Key].(string)
+	if !ok {
+		return "", errors.New("Type assertion failed on the value.")
 	}
+	return v, nil
+}
 
-	pair, X509Err := tls.X509KeyPair([]byte(cert), []byte(key))
-	if X509Err != nil {
-		return nil, X509Err
-	}
+// Resolvers offers the default config resolvers, plus the SkeletonKey for the
+// bao:// scheme.
+func (sk *SkeletonKey) Resolvers() config.Resolvers {
+	return config.DefaultResolvers().With("bao", sk)
+}
 
-	return &pair, nil
+// ReadTlsCertAndKey expects a custom struct named TlsSecret in the Config file.
+// It will assemble a x509 certificate and key from whichever source the
+// TlsSecret declares. Local files and inline values don't need Openbao.
+func (sk *SkeletonKey) ReadTlsCertAndKey(tlsInfo *config.TlsSecret) (*tls.Certificate, error) {
+	return readTlsCertAndKey(sk, tlsInfo)
 }
 
 // ReadIntermediateCA expects a custom struct named HttpServer in the Config
 // file. It will read a base64 encoded value from Openbao, and return bytes.
+// When SecretCA is blank, then the CA of the TlsClient source is read instead.
 func (sk *SkeletonKey) ReadIntermediateCA(cfg *config.HttpServer) ([]byte, error) {
-	ca64, ca64Err := sk.ReadPathAndKey(cfg.SecretCA, cfg.SecretCAKey)
-	if ca64Err != nil {
-		return nil, ca64Err
-	}
-
-	cert, decodeCertErr := base64.StdEncoding.DecodeString(ca64)
-	if decodeCertErr != nil {
-		return nil, decodeCertErr
-	}
-
-	return cert, nil
+	return IntermediateCA(sk, cfg)
 }
 
 // CreateCertPool expects a custom struct named HttpServer in the Config file.
 // It will read a base64 encoded value from Openbao, then use that certificate
 // to configure a certPool.
 func (sk *SkeletonKey) CreateCertPool(cfg *config.HttpServer) (*x509.CertPool, error) {
-	ca, caErr := sk.ReadIntermediateCA(cfg)
-	if caErr != nil {
-		return nil, caErr
-	}
-
-	certPool := x509.NewCertPool()
-	certPool.AppendCertsFromPEM(ca)
-	return certPool, nil
+	return CertPool(sk, cfg)
 }
 
 // ConfigureTLSwithCA expects a custom struct named HttpServer in the Config
 // file. It will assemble a tls.Config with a CA, cert, and TLS 1.3
 func (sk *SkeletonKey) ConfigureTLSwithCA(cfg *config.HttpServer) (*tls.Config, error) {
-	clientCert, ccErr := sk.ReadTlsCertAndKey(cfg.TlsClient)
-	if ccErr != nil {
-		return nil, ccErr
-	}
-
-	certPool, cpErr := sk.CreateCertPool(cfg)
-	if cpErr != nil {
-		return nil, cpErr
-	}
-
-	return &tls.Config{
-		MinVersion:   tls.VersionTLS13,
-		Certificates: []tls.Certificate{*clientCert},
-		RootCAs: certPool,
-	}, nil
+	return ClientTLS(sk, cfg)
 }
 
-// LogicalRead expects an Openbao endpoint to GET.
+// LogicalRead expects an Openbao endpoint to GET. An empty path is reported as
+// ErrNotFound.
 func (sk *SkeletonKey) LogicalRead(secretPath string) (*openbao.Secret, error) {
+	return sk.LogicalReadContext(context.Background(), secretPath)
+}
+
+// LogicalReadContext is LogicalRead bounded by a context, and by the
+// configured timeout.
+func (sk *SkeletonKey) LogicalReadContext(ctx context.Context, secretPath string) (*openbao.Secret, error) {
+	ctx, cancel := sk.callContext(ctx)
+	defer cancel()
+
 	logicalClient := sk.Openbao.Logical()
-	secret, secretErr := logicalClient.Read(secretPath)
+	secret, secretErr := logicalClient.ReadWithContext(ctx, secretPath)
 	if secretErr != nil {
-		return nil, secretErr
+		return nil, wrapErr("read", secretPath, secretErr)
+	}
+	if secret == nil {
+		return nil, &Error{Op: "read", Path: secretPath, Kind: ErrNotFound, Err: ErrNotFound}
 	}
 
 	return secret, nil
@@ -170,10 +214,19 @@ type payload map[string]any
 
 // LogicalWrite expects an Openbao endpoint and a map of data to PUT.
 func (sk *SkeletonKey) LogicalWrite(path string, data payload) (*openbao.Secret, error) {
+	return sk.LogicalWriteContext(context.Background(), path, data)
+}
+
+// LogicalWriteContext is LogicalWrite bounded by a context, and by the
+// configured timeout.
+func (sk *SkeletonKey) LogicalWriteContext(ctx context.Context, path string, data payload) (*openbao.Secret, error) {
+	ctx, cancel := sk.callContext(ctx)
+	defer cancel()
+
 	logicalClient := sk.Openbao.Logical()
-	secret, secretErr := logicalClient.Write(path, data)
+	secret, secretErr := logicalClient.WriteWithContext(ctx, path, data)
 	if secretErr != nil {
-		return nil, secretErr
+		return nil, wrapErr("write", path, secretErr)
 	}
 
 	return secret, nil
@@ -258,6 +311,11 @@ type OtpKey struct {
 // generated by the TOTP Engine of Openbao. The TOTP Engine must be enabled on
 // the Openbao server prior to calling it.
 func (sk *SkeletonKey) OTPcreateKey(data OtpPayload) (*OtpKey, error) {
+	return sk.OTPcreateKeyContext(context.Background(), data)
+}
+
+// OTPcreateKeyContext is OTPcreateKey bounded by a context.
+func (sk *SkeletonKey) OTPcreateKeyContext(ctx context.Context, data OtpPayload) (*OtpKey, error) {
 	validationErr := validateOtpPayload(data)
 	if validationErr != nil {
 		return nil, validationErr
@@ -273,10 +331,13 @@ func (sk *SkeletonKey) OTPcreateKey(data OtpPayload) (*OtpKey, error) {
 		"account_name": data.AccountName,
 	}
 
-	secret, secErr := sk.LogicalWrite(fullPath, info)
+	secret, secErr := sk.LogicalWriteContext(ctx, fullPath, info)
 	if secErr != nil {
 		return nil, secErr
 	}
+	if secret == nil {
+		return nil, errors.New("Openbao TOTP Engine returned no key.")
+	}
 
 	barcode, ok := secret.Data["barcode"].(string)
 	if !ok {
@@ -300,6 +361,11 @@ func (sk *SkeletonKey) OTPcreateKey(data OtpPayload) (*OtpKey, error) {
 // nothing is returned. The key will reside on Openbao. This is useful for
 // adding existing TOTP Keys to a blank Openbao TOTP Engine.
 func (sk *SkeletonKey) OTPaddKey(data OtpPayload) error {
+	return sk.OTPaddKeyContext(context.Background(), data)
+}
+
+// OTPaddKeyContext is OTPaddKey bounded by a context.
+func (sk *SkeletonKey) OTPaddKeyContext(ctx context.Context, data OtpPayload) error {
 	if data.Generate == true {
 		return errors.New("Disable generation when trying to add existing TOTP key.")
 	}
@@ -314,7 +380,7 @@ func (sk *SkeletonKey) OTPaddKey(data OtpPayload) error {
 		"key":      data.Key,
 	}
 
-	_, writeErr := sk.LogicalWrite(fullPath, info)
+	_, writeErr := sk.LogicalWriteContext(ctx, fullPath, info)
 	if writeErr != nil {
 		return writeErr
 	}
@@ -322,6 +388,27 @@ func (sk *SkeletonKey) OTPaddKey(data OtpPayload) error {
 	return nil
 }
 
+// OTPdeleteKey expects an OtpPayload naming an existing key, and removes that
+// key from the Openbao TOTP Engine.
+func (sk *SkeletonKey) OTPdeleteKey(data OtpPayload) error {
+	return sk.OTPdeleteKeyContext(context.Background(), data)
+}
+
+// OTPdeleteKeyContext is OTPdeleteKey bounded by a context.
+func (sk *SkeletonKey) OTPdeleteKeyContext(ctx context.Context, data OtpPayload) error {
+	fullPath := data.Path + data.Name
+
+	ctx, cancel := sk.callContext(ctx)
+	defer cancel()
+
+	_, deleteErr := sk.Openbao.Logical().DeleteWithContext(ctx, fullPath)
+	if deleteErr != nil {
+		return wrapErr("delete", fullPath, deleteErr)
+	}
+
+	return nil
+}
+
 // OtpCode prepares a request to validate a TOTP Code.
 type OtpCode struct {
 	// Path is the beginning of the URL request to the TOTP Engine. This is
@@ -342,15 +429,24 @@ func (sk *SkeletonKey) OTPdraftCode(name string, code string) OtpCode {
 }
 
 func (sk *SkeletonKey) OTPverifyCode(data OtpCode) (bool, error) {
+	return sk.OTPverifyCodeContext(context.Background(), data)
+}
+
+// OTPverifyCodeContext is OTPverifyCode bounded by a context, e.g., the
+// context of a HTTP request.
+func (sk *SkeletonKey) OTPverifyCodeContext(ctx context.Context, data OtpCode) (bool, error) {
 	fullPath := data.Path + data.Name
 	info := payload{
 		"code": data.Code,
 	}
 
-	secret, secretErr := sk.LogicalWrite(fullPath, info)
+	secret, secretErr := sk.LogicalWriteContext(ctx, fullPath, info)
 	if secretErr != nil {
 		return false, secretErr
 	}
+	if secret == nil {
+		return false, errors.New("Openbao TOTP Engine returned no verdict.")
+	}
 
 	valid, ok := secret.Data["valid"].(bool)
 	if !ok {
@@ -385,16 +481,25 @@ func (sk *SkeletonKey) HashDraftPayload(input string) HashPayload {
 
 // Hash transmits data to the Openbao Transit Engine for hashing and returns a string.
 func (sk *SkeletonKey) Hash(data HashPayload) (string, error) {
+	return sk.HashContext(context.Background(), data)
+}
+
+// HashContext is Hash bounded by a context, e.g., the context of a HTTP
+// request.
+func (sk *SkeletonKey) HashContext(ctx context.Context, data HashPayload) (string, error) {
 	fullPath := data.Path + data.Algo
 	info := payload{
 		"input":  data.Input,
 		"format": data.Format,
 	}
 
-	secret, secretErr := sk.LogicalWrite(fullPath, info)
+	secret, secretErr := sk.LogicalWriteContext(ctx, fullPath, info)
 	if secretErr != nil {
 		return "", secretErr
 	}
+	if secret == nil {
+		return "", errors.New("Openbao returned no hash.")
+	}
 
 	digest, ok := secret.Data["sum"].(string)
 	if !ok {
@@ -419,8 +524,8 @@ type TokenPayload struct {
 // DraftTokenPayload assembles a sanely configured payload for the Openbao Transit Engine.
 func (sk *SkeletonKey) DraftTokenPayload() TokenPayload {
 	return TokenPayload{
-		Path: "transit/random/",
-		Bytes: 32,
+		Path:   "transit/random/",
+		Bytes:  32,
 		Format: "base64",
 		Source: "platform/",
 	}
@@ -428,16 +533,24 @@ func (sk *SkeletonKey) DraftTokenPayload() TokenPayload {
 
 // CreateToken transmits data to the Openbao Transit Engine and returns a random token.
 func (sk *SkeletonKey) CreateToken(data TokenPayload) (string, error) {
+	return sk.CreateTokenContext(context.Background(), data)
+}
+
+// CreateTokenContext is CreateToken bounded by a context.
+func (sk *SkeletonKey) CreateTokenContext(ctx context.Context, data TokenPayload) (string, error) {
 	fullPath := data.Path + data.Source
 	info := payload{
-		"bytes": data.Bytes,
+		"bytes":  data.Bytes,
 		"format": data.Format,
 	}
 
-	secret, secretErr := sk.LogicalWrite(fullPath, info)
+	secret, secretErr := sk.LogicalWriteContext(ctx, fullPath, info)
 	if secretErr != nil {
 		return "", secretErr
 	}
+	if secret == nil {
+		return "", errors.New("Openbao returned no random bytes.")
+	}
 
 	token, ok := secret.Data["random_bytes"].(string)
 	if !ok {
@@ -20,7 +20,8 @@ func Test_PostgresPassword(t *testing.T) {
 	t.Setenv("APP_ENV", "DEV")
 	t.Setenv("OPENBAO_TOKEN", "token")
 
-	cfg := config.Read()
+	cfg, cfgErr := config.Read()
+	Ok(t, cfgErr)
 	db := cfg.Data.Relational[0]
 	sk := new(SkeletonKey)
 	sk.Create(cfg)
@@ -35,7 +36,8 @@ func Test_ReadValueFromOpenbao(t *testing.T) {
 	t.Setenv("APP_ENV", "DEV")
 	t.Setenv("OPENBAO_TOKEN", "token")
 
-	cfg := config.Read()
+	cfg, cfgErr := config.Read()
+	Ok(t, cfgErr)
 	sk := new(SkeletonKey)
 	sk.Create(cfg)
 
@@ -49,7 +51,8 @@ func Test_ReadIntermediateCA(t *testing.T) {
 	t.Setenv("APP_ENV", "DEV")
 	t.Setenv("OPENBAO_TOKEN", "token")
 
-	cfg := config.Read()
+	cfg, cfgErr := config.Read()
+	Ok(t, cfgErr)
 	sk := new(SkeletonKey)
 	sk.Create(cfg)
 
@@ -61,7 +64,8 @@ func Test_CreateCertPool(t *testing.T) {
 	t.Setenv("APP_ENV", "DEV")
 	t.Setenv("OPENBAO_TOKEN", "token")
 
-	cfg := config.Read()
+	cfg, cfgErr := config.Read()
+	Ok(t, cfgErr)
 	sk := new(SkeletonKey)
 	sk.Create(cfg)
 
@@ -73,7 +77,8 @@ func Test_CreateTLSwithCA(t *testing.T) {
 	t.Setenv("APP_ENV", "DEV")
 	t.Setenv("OPENBAO_TOKEN", "token")
 
-	cfg := config.Read()
+	cfg, cfgErr := config.Read()
+	Ok(t, cfgErr)
 	sk := new(SkeletonKey)
 	sk.Create(cfg)
 
@@ -81,3 +86,19 @@ func Test_CreateTLSwithCA(t *testing.T) {
 	Ok(t, err)
 	Equals(t, 1, len(tlsConfig.Certificates))
 }
+
+func Test_ResolveReference(t *testing.T) {
+	t.Setenv("APP_ENV", "DEV")
+	t.Setenv("OPENBAO_TOKEN", "token")
+
+	cfg, cfgErr := config.Read()
+	Ok(t, cfgErr)
+	sk := new(SkeletonKey)
+	sk.Create(cfg)
+
+	cfg.Cache.Host = "bao://secret/" + REDIS_SECRET + "#password"
+	err := cfg.ResolveRefs(sk.Resolvers())
+
+	Ok(t, err)
+	Equals(t, REDIS_PW, cfg.Cache.Host)
+}
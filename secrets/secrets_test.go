@@ -1,9 +1,19 @@
 package secrets_test
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/Shoowa/vamos/config"
 	. "github.com/Shoowa/vamos/secrets"
@@ -20,7 +30,8 @@ func Test_SkeletonKeyOpenbao(t *testing.T) {
 	t.Setenv("APP_ENV", "DEV")
 	t.Setenv("OPENBAO_TOKEN", "token")
 
-	cfg := config.Read()
+	cfg, cfgErr := config.Read()
+	Ok(t, cfgErr)
 	sk := new(SkeletonKey)
 	sk.Create(cfg)
 
@@ -29,3 +40,63 @@ func Test_SkeletonKeyOpenbao(t *testing.T) {
 	Assert(t, strings.Contains(addr, "localhost"), "Lacks localhost in host address.")
 	Assert(t, strings.Contains(tok, "token"), "Lacks token from environment.")
 }
+
+// selfSigned creates a PEM encoded certificate & key that can act as its own
+// CA.
+func selfSigned(t *testing.T, cn string) ([]byte, []byte) {
+	key, keyErr := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Ok(t, keyErr)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		DNSNames:              []string{cn},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, derErr := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Ok(t, derErr)
+
+	keyDer, keyDerErr := x509.MarshalPKCS8PrivateKey(key)
+	Ok(t, keyDerErr)
+
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer})
+	return certPem, keyPem
+}
+
+func Test_ReadTlsCertAndKey_LocalSources(t *testing.T) {
+	certPem, keyPem := selfSigned(t, "localhost")
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	Ok(t, os.WriteFile(certPath, certPem, 0o600))
+	Ok(t, os.WriteFile(keyPath, keyPem, 0o600))
+
+	// Neither source needs a connection to Openbao.
+	sk := new(SkeletonKey)
+
+	files := &config.TlsSecret{
+		Source:   config.TLS_FILE,
+		CaPath:   certPath,
+		CertPath: certPath,
+		KeyPath:  keyPath,
+	}
+	fromFiles, filesErr := sk.ConfigureTLS(files)
+	Ok(t, filesErr)
+	Equals(t, 1, len(fromFiles.Certificates))
+	Assert(t, fromFiles.RootCAs != nil, "Lacks a CA pool from a local file.")
+
+	inline := &config.TlsSecret{
+		Source:  config.TLS_INLINE,
+		CertPem: string(certPem),
+		KeyPem:  base64.StdEncoding.EncodeToString(keyPem),
+	}
+	fromInline, inlineErr := sk.ReadTlsCertAndKey(inline)
+	Ok(t, inlineErr)
+	Equals(t, fromFiles.Certificates[0].Certificate, fromInline.Certificate)
+}
@@ -0,0 +1,214 @@
+package secrets
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Shoowa/vamos/config"
+)
+
+var errPkiProvider = errors.New("The openbao_pki source needs the Openbao provider.")
+
+// ReadCA reads the CA declared by a TlsSecret, and returns PEM bytes. A source
+// lacking a CA returns nil.
+func (sk *SkeletonKey) ReadCA(tlsInfo *config.TlsSecret) ([]byte, error) {
+	return readCA(sk, tlsInfo)
+}
+
+// readCA reads a CA through any Provider. The openbao_kv source is read with
+// the ReadKey method of the Provider, and the openbao_pki source needs the
+// SkeletonKey.
+func readCA(p Provider, tlsInfo *config.TlsSecret) ([]byte, error) {
+	switch tlsInfo.Source {
+	case config.TLS_FILE:
+		if tlsInfo.CaPath == "" {
+			return nil, nil
+		}
+		return os.ReadFile(tlsInfo.CaPath)
+	case config.TLS_OPENBAO_KV:
+		if tlsInfo.CaPath == "" {
+			return nil, nil
+		}
+		ca, caErr := p.ReadKey(context.Background(), tlsInfo.Mount, tlsInfo.CaPath, tlsInfo.CaField)
+		if caErr != nil {
+			return nil, caErr
+		}
+		return decodePem(ca)
+	case config.TLS_OPENBAO_PKI:
+		sk, isOpenbao := p.(*SkeletonKey)
+		if !isOpenbao {
+			return nil, errPkiProvider
+		}
+		return sk.readPkiCaChain(context.Background(), pkiRequest(tlsInfo).mount())
+	case config.TLS_INLINE:
+		if tlsInfo.CaPem == "" {
+			return nil, nil
+		}
+		return decodePem(tlsInfo.CaPem)
+	default:
+		return nil, fmt.Errorf("Unknown TLS source %q.", tlsInfo.Source)
+	}
+}
+
+// readTlsCertAndKey assembles a certificate & key through any Provider.
+func readTlsCertAndKey(p Provider, tlsInfo *config.TlsSecret) (*tls.Certificate, error) {
+	switch tlsInfo.Source {
+	case config.TLS_FILE:
+		pair, err := tls.LoadX509KeyPair(tlsInfo.CertPath, tlsInfo.KeyPath)
+		if err != nil {
+			return nil, err
+		}
+		return &pair, nil
+	case config.TLS_OPENBAO_KV:
+		return readKeyedCertAndKey(p, tlsInfo)
+	case config.TLS_OPENBAO_PKI:
+		sk, isOpenbao := p.(*SkeletonKey)
+		if !isOpenbao {
+			return nil, errPkiProvider
+		}
+		return sk.issuePkiCert(tlsInfo)
+	case config.TLS_INLINE:
+		return readInlineCertAndKey(tlsInfo)
+	default:
+		return nil, fmt.Errorf("Unknown TLS source %q.", tlsInfo.Source)
+	}
+}
+
+// readKeyedCertAndKey assembles a x509 certificate and key stored as PEM
+// values, or base64 encoded PEM values, under keys of the Provider.
+func readKeyedCertAndKey(p Provider, tlsInfo *config.TlsSecret) (*tls.Certificate, error) {
+	ctx := context.Background()
+	certValue, certErr := p.ReadKey(ctx, tlsInfo.Mount, tlsInfo.CertPath, tlsInfo.CertField)
+	if certErr != nil {
+		return nil, certErr
+	}
+
+	keyValue, keyErr := p.ReadKey(ctx, tlsInfo.Mount, tlsInfo.KeyPath, tlsInfo.KeyField)
+	if keyErr != nil {
+		return nil, keyErr
+	}
+
+	cert, decodeCertErr := decodePem(certValue)
+	if decodeCertErr != nil {
+		return nil, decodeCertErr
+	}
+
+	key, decodeKeyErr := decodePem(keyValue)
+	if decodeKeyErr != nil {
+		return nil, decodeKeyErr
+	}
+
+	pair, X509Err := tls.X509KeyPair(cert, key)
+	if X509Err != nil {
+		return nil, X509Err
+	}
+
+	return &pair, nil
+}
+
+// ConfigureTLS assembles a tls.Config with TLS 1.3 from a single TlsSecret.
+// The cert is included when the source offers one, and the CA becomes the
+// pool of root CAs when the source offers one.
+func (sk *SkeletonKey) ConfigureTLS(tlsInfo *config.TlsSecret) (*tls.Config, error) {
+	return ConfigureTLS(sk, tlsInfo)
+}
+
+// ConfigureTLS is the ConfigureTLS method for any Provider.
+func ConfigureTLS(p Provider, tlsInfo *config.TlsSecret) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS13}
+
+	if hasCert(tlsInfo) {
+		cert, certErr := p.ReadTlsCertAndKey(tlsInfo)
+		if certErr != nil {
+			return nil, certErr
+		}
+		tlsConfig.Certificates = []tls.Certificate{*cert}
+	}
+
+	ca, caErr := p.ReadCA(tlsInfo)
+	if caErr != nil {
+		return nil, caErr
+	}
+	if ca != nil {
+		pool, poolErr := certPool(ca)
+		if poolErr != nil {
+			return nil, poolErr
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+// hasCert reports whether a TlsSecret offers a certificate, rather than only a
+// CA.
+func hasCert(tlsInfo *config.TlsSecret) bool {
+	switch tlsInfo.Source {
+	case config.TLS_OPENBAO_PKI:
+		return true
+	case config.TLS_INLINE:
+		return tlsInfo.CertPem != ""
+	default:
+		return tlsInfo.CertPath != ""
+	}
+}
+
+func certPool(ca []byte) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("No PEM certificates found in the CA.")
+	}
+	return pool, nil
+}
+
+// decodePem accepts a PEM value, or a base64 encoded PEM value.
+func decodePem(value string) ([]byte, error) {
+	if strings.HasPrefix(strings.TrimSpace(value), "-----BEGIN") {
+		return []byte(value), nil
+	}
+	return base64.StdEncoding.DecodeString(value)
+}
+
+func readInlineCertAndKey(tlsInfo *config.TlsSecret) (*tls.Certificate, error) {
+	cert, certErr := decodePem(tlsInfo.CertPem)
+	if certErr != nil {
+		return nil, certErr
+	}
+
+	key, keyErr := decodePem(tlsInfo.KeyPem)
+	if keyErr != nil {
+		return nil, keyErr
+	}
+
+	pair, X509Err := tls.X509KeyPair(cert, key)
+	if X509Err != nil {
+		return nil, X509Err
+	}
+	return &pair, nil
+}
+
+// pkiRequest translates the openbao_pki source into a CertRequest.
+func pkiRequest(tlsInfo *config.TlsSecret) CertRequest {
+	return CertRequest{
+		Mount:      tlsInfo.Mount,
+		Role:       tlsInfo.Role,
+		CommonName: tlsInfo.CommonName,
+		AltNames:   tlsInfo.AltNames,
+		Ttl:        tlsInfo.Ttl,
+	}
+}
+
+// issuePkiCert obtains a certificate from the Openbao PKI engine, either by
+// signing a local CSR, or by issuing a new key & certificate.
+func (sk *SkeletonKey) issuePkiCert(tlsInfo *config.TlsSecret) (*tls.Certificate, error) {
+	if tlsInfo.SignCsr {
+		return sk.PKIsignCSR(pkiRequest(tlsInfo))
+	}
+	return sk.PKIissueCert(pkiRequest(tlsInfo))
+}
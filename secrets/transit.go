@@ -0,0 +1,518 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TRANSIT_PATH is the usual mount of the Openbao Transit Engine.
+const TRANSIT_PATH = "transit/"
+
+// EncryptPayload prepares a request to the Transit Engine to encrypt data.
+type EncryptPayload struct {
+	// Path is the beginning of a URL request to the Transit Engine.
+	Path string
+	// Name selects an encryption key, and is part of the URL path.
+	Name string
+	// Plaintext is the base64 encoded value to encrypt.
+	Plaintext string
+	// Context is a base64 encoded value required by keys with derivation.
+	Context string
+	// KeyVersion selects an older version of the key. Zero uses the latest.
+	KeyVersion int
+}
+
+// EncryptDraftPayload assembles a sanely configured payload.
+func (sk *SkeletonKey) EncryptDraftPayload(name string, plaintext []byte) EncryptPayload {
+	return EncryptPayload{
+		Path:      TRANSIT_PATH + "encrypt/",
+		Name:      name,
+		Plaintext: base64.StdEncoding.EncodeToString(plaintext),
+	}
+}
+
+// Encrypt transmits data to the Transit Engine, and returns a ciphertext such
+// as vault:v1:... that names the key version.
+func (sk *SkeletonKey) Encrypt(data EncryptPayload) (string, error) {
+	return sk.EncryptContext(context.Background(), data)
+}
+
+// EncryptContext is Encrypt bounded by a context.
+func (sk *SkeletonKey) EncryptContext(ctx context.Context, data EncryptPayload) (string, error) {
+	info := payload{"plaintext": data.Plaintext}
+	withContext(info, data.Context)
+	withKeyVersion(info, data.KeyVersion)
+
+	result, resultErr := sk.transitWrite(ctx, data.Path+data.Name, info)
+	if resultErr != nil {
+		return "", resultErr
+	}
+	return stringField(result, "ciphertext")
+}
+
+// DecryptPayload prepares a request to the Transit Engine to decrypt data.
+type DecryptPayload struct {
+	// Path is the beginning of a URL request to the Transit Engine.
+	Path string
+	// Name selects an encryption key, and is part of the URL path.
+	Name string
+	// Ciphertext was returned by Encrypt.
+	Ciphertext string
+	// Context is a base64 encoded value required by keys with derivation.
+	Context string
+}
+
+// DecryptDraftPayload assembles a sanely configured payload.
+func (sk *SkeletonKey) DecryptDraftPayload(name string, ciphertext string) DecryptPayload {
+	return DecryptPayload{
+		Path:       TRANSIT_PATH + "decrypt/",
+		Name:       name,
+		Ciphertext: ciphertext,
+	}
+}
+
+// Decrypt transmits a ciphertext to the Transit Engine, and returns the
+// decoded plaintext.
+func (sk *SkeletonKey) Decrypt(data DecryptPayload) ([]byte, error) {
+	return sk.DecryptContext(context.Background(), data)
+}
+
+// DecryptContext is Decrypt bounded by a context.
+func (sk *SkeletonKey) DecryptContext(ctx context.Context, data DecryptPayload) ([]byte, error) {
+	info := payload{"ciphertext": data.Ciphertext}
+	withContext(info, data.Context)
+
+	result, resultErr := sk.transitWrite(ctx, data.Path+data.Name, info)
+	if resultErr != nil {
+		return nil, resultErr
+	}
+
+	plaintext, fieldErr := stringField(result, "plaintext")
+	if fieldErr != nil {
+		return nil, fieldErr
+	}
+	return base64.StdEncoding.DecodeString(plaintext)
+}
+
+// RewrapPayload prepares a request to the Transit Engine to encrypt a
+// ciphertext again with the latest, or a chosen, version of the key. The
+// plaintext is never revealed.
+type RewrapPayload struct {
+	// Path is the beginning of a URL request to the Transit Engine.
+	Path string
+	// Name selects an encryption key, and is part of the URL path.
+	Name string
+	// Ciphertext was returned by Encrypt.
+	Ciphertext string
+	// Context is a base64 encoded value required by keys with derivation.
+	Context string
+	// KeyVersion selects the version of the key. Zero uses the latest.
+	KeyVersion int
+}
+
+// RewrapDraftPayload assembles a sanely configured payload.
+func (sk *SkeletonKey) RewrapDraftPayload(name string, ciphertext string) RewrapPayload {
+	return RewrapPayload{
+		Path:       TRANSIT_PATH + "rewrap/",
+		Name:       name,
+		Ciphertext: ciphertext,
+	}
+}
+
+// Rewrap transmits a ciphertext to the Transit Engine, and returns a new
+// ciphertext.
+func (sk *SkeletonKey) Rewrap(data RewrapPayload) (string, error) {
+	return sk.RewrapContext(context.Background(), data)
+}
+
+// RewrapContext is Rewrap bounded by a context.
+func (sk *SkeletonKey) RewrapContext(ctx context.Context, data RewrapPayload) (string, error) {
+	info := payload{"ciphertext": data.Ciphertext}
+	withContext(info, data.Context)
+	withKeyVersion(info, data.KeyVersion)
+
+	result, resultErr := sk.transitWrite(ctx, data.Path+data.Name, info)
+	if resultErr != nil {
+		return "", resultErr
+	}
+	return stringField(result, "ciphertext")
+}
+
+// BatchItem is a single value inside a batch request. Either the Plaintext or
+// the Ciphertext is filled, depending on the operation.
+type BatchItem struct {
+	// Plaintext is a base64 encoded value.
+	Plaintext string `json:"plaintext,omitempty"`
+	// Ciphertext was returned by Encrypt.
+	Ciphertext string `json:"ciphertext,omitempty"`
+	// Context is a base64 encoded value required by keys with derivation.
+	Context string `json:"context,omitempty"`
+}
+
+// BatchPayload prepares a single request to the Transit Engine that encrypts,
+// decrypts, or rewraps many values.
+type BatchPayload struct {
+	// Path is the beginning of a URL request to the Transit Engine, and
+	// decides the operation.
+	Path string
+	// Name selects an encryption key, and is part of the URL path.
+	Name string
+	// Items are processed in order.
+	Items []BatchItem
+}
+
+// EncryptBatchDraftPayload assembles a payload to encrypt many values.
+func (sk *SkeletonKey) EncryptBatchDraftPayload(name string, plaintexts ...[]byte) BatchPayload {
+	items := make([]BatchItem, len(plaintexts))
+	for i, plaintext := range plaintexts {
+		items[i].Plaintext = base64.StdEncoding.EncodeToString(plaintext)
+	}
+	return BatchPayload{Path: TRANSIT_PATH + "encrypt/", Name: name, Items: items}
+}
+
+// DecryptBatchDraftPayload assembles a payload to decrypt many values.
+func (sk *SkeletonKey) DecryptBatchDraftPayload(name string, ciphertexts ...string) BatchPayload {
+	items := make([]BatchItem, len(ciphertexts))
+	for i, ciphertext := range ciphertexts {
+		items[i].Ciphertext = ciphertext
+	}
+	return BatchPayload{Path: TRANSIT_PATH + "decrypt/", Name: name, Items: items}
+}
+
+// EncryptBatch returns a ciphertext for each item, in order. It also serves
+// rewrap requests.
+func (sk *SkeletonKey) EncryptBatch(data BatchPayload) ([]string, error) {
+	return sk.EncryptBatchContext(context.Background(), data)
+}
+
+// EncryptBatchContext is EncryptBatch bounded by a context.
+func (sk *SkeletonKey) EncryptBatchContext(ctx context.Context, data BatchPayload) ([]string, error) {
+	results, batchErr := sk.batch(ctx, data)
+	if batchErr != nil {
+		return nil, batchErr
+	}
+
+	ciphertexts := make([]string, len(results))
+	for i, result := range results {
+		ciphertexts[i] = result.Ciphertext
+	}
+	return ciphertexts, nil
+}
+
+// DecryptBatch returns the decoded plaintext of each item, in order.
+func (sk *SkeletonKey) DecryptBatch(data BatchPayload) ([][]byte, error) {
+	return sk.DecryptBatchContext(context.Background(), data)
+}
+
+// DecryptBatchContext is DecryptBatch bounded by a context.
+func (sk *SkeletonKey) DecryptBatchContext(ctx context.Context, data BatchPayload) ([][]byte, error) {
+	results, batchErr := sk.batch(ctx, data)
+	if batchErr != nil {
+		return nil, batchErr
+	}
+
+	plaintexts := make([][]byte, len(results))
+	for i, result := range results {
+		plaintext, decodeErr := base64.StdEncoding.DecodeString(result.Plaintext)
+		if decodeErr != nil {
+			return nil, decodeErr
+		}
+		plaintexts[i] = plaintext
+	}
+	return plaintexts, nil
+}
+
+type batchResult struct {
+	Plaintext  string `json:"plaintext"`
+	Ciphertext string `json:"ciphertext"`
+	Error      string `json:"error"`
+}
+
+// batch sends every item in a single request. The failure of any item fails
+// the whole batch, and each failed item is reported with its index.
+func (sk *SkeletonKey) batch(ctx context.Context, data BatchPayload) ([]batchResult, error) {
+	info := payload{"batch_input": data.Items}
+
+	result, resultErr := sk.transitWrite(ctx, data.Path+data.Name, info)
+	if resultErr != nil {
+		return nil, resultErr
+	}
+
+	raw, marshalErr := json.Marshal(result["batch_results"])
+	if marshalErr != nil {
+		return nil, marshalErr
+	}
+	results := []batchResult{}
+	unmarshalErr := json.Unmarshal(raw, &results)
+	if unmarshalErr != nil {
+		return nil, unmarshalErr
+	}
+	if len(results) != len(data.Items) {
+		return nil, fmt.Errorf("Transit Engine returned %v results for %v items.", len(results), len(data.Items))
+	}
+
+	var errs []error
+	for i, result := range results {
+		if result.Error != "" {
+			errs = append(errs, fmt.Errorf("Batch item %v: %v", i, result.Error))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return results, nil
+}
+
+// SignPayload prepares a request to the Transit Engine to sign data with an
+// asymmetric key.
+type SignPayload struct {
+	// Path is the beginning of a URL request to the Transit Engine.
+	Path string
+	// Name selects a signing key, and is part of the URL path.
+	Name string
+	// Input is the base64 encoded value to sign.
+	Input string
+	// Algo selects a hashing algorithm offered by the Transit Engine.
+	Algo string
+	// KeyVersion selects an older version of the key. Zero uses the latest.
+	KeyVersion int
+}
+
+// SignDraftPayload assembles a sanely configured payload.
+func (sk *SkeletonKey) SignDraftPayload(name string, input []byte) SignPayload {
+	return SignPayload{
+		Path:  TRANSIT_PATH + "sign/",
+		Name:  name,
+		Input: base64.StdEncoding.EncodeToString(input),
+		Algo:  "sha2-256",
+	}
+}
+
+// Sign returns a signature such as vault:v1:... that names the key version.
+func (sk *SkeletonKey) Sign(data SignPayload) (string, error) {
+	return sk.SignContext(context.Background(), data)
+}
+
+// SignContext is Sign bounded by a context.
+func (sk *SkeletonKey) SignContext(ctx context.Context, data SignPayload) (string, error) {
+	info := payload{
+		"input":          data.Input,
+		"hash_algorithm": data.Algo,
+	}
+	withKeyVersion(info, data.KeyVersion)
+
+	result, resultErr := sk.transitWrite(ctx, data.Path+data.Name, info)
+	if resultErr != nil {
+		return "", resultErr
+	}
+	return stringField(result, "signature")
+}
+
+// HmacPayload prepares a request to the Transit Engine to create a HMAC.
+type HmacPayload struct {
+	// Path is the beginning of a URL request to the Transit Engine.
+	Path string
+	// Name selects a key, and is part of the URL path.
+	Name string
+	// Input is the base64 encoded value to authenticate.
+	Input string
+	// Algo selects a hashing algorithm offered by the Transit Engine.
+	Algo string
+	// KeyVersion selects an older version of the key. Zero uses the latest.
+	KeyVersion int
+}
+
+// HmacDraftPayload assembles a sanely configured payload.
+func (sk *SkeletonKey) HmacDraftPayload(name string, input []byte) HmacPayload {
+	return HmacPayload{
+		Path:  TRANSIT_PATH + "hmac/",
+		Name:  name,
+		Input: base64.StdEncoding.EncodeToString(input),
+		Algo:  "sha2-256",
+	}
+}
+
+// Hmac returns a HMAC such as vault:v1:... that names the key version.
+func (sk *SkeletonKey) Hmac(data HmacPayload) (string, error) {
+	return sk.HmacContext(context.Background(), data)
+}
+
+// HmacContext is Hmac bounded by a context.
+func (sk *SkeletonKey) HmacContext(ctx context.Context, data HmacPayload) (string, error) {
+	info := payload{
+		"input":     data.Input,
+		"algorithm": data.Algo,
+	}
+	withKeyVersion(info, data.KeyVersion)
+
+	result, resultErr := sk.transitWrite(ctx, data.Path+data.Name, info)
+	if resultErr != nil {
+		return "", resultErr
+	}
+	return stringField(result, "hmac")
+}
+
+// VerifyPayload prepares a request to the Transit Engine to verify either a
+// Signature or a HMAC.
+type VerifyPayload struct {
+	// Path is the beginning of a URL request to the Transit Engine.
+	Path string
+	// Name selects a key, and is part of the URL path.
+	Name string
+	// Input is the base64 encoded value that was signed.
+	Input string
+	// Algo selects the hashing algorithm used to sign.
+	Algo string
+	// Signature was returned by Sign.
+	Signature string
+	// Hmac was returned by Hmac.
+	Hmac string
+}
+
+// VerifyDraftPayload assembles a sanely configured payload. Fill either the
+// Signature or the Hmac afterwards.
+func (sk *SkeletonKey) VerifyDraftPayload(name string, input []byte) VerifyPayload {
+	return VerifyPayload{
+		Path:  TRANSIT_PATH + "verify/",
+		Name:  name,
+		Input: base64.StdEncoding.EncodeToString(input),
+		Algo:  "sha2-256",
+	}
+}
+
+// Verify reports whether the Signature or the Hmac matches the Input.
+func (sk *SkeletonKey) Verify(data VerifyPayload) (bool, error) {
+	return sk.VerifyContext(context.Background(), data)
+}
+
+// VerifyContext is Verify bounded by a context.
+func (sk *SkeletonKey) VerifyContext(ctx context.Context, data VerifyPayload) (bool, error) {
+	if (data.Signature == "") == (data.Hmac == "") {
+		return false, errors.New("Transit verification needs either a signature or a HMAC.")
+	}
+
+	info := payload{
+		"input":          data.Input,
+		"hash_algorithm": data.Algo,
+	}
+	if data.Signature != "" {
+		info["signature"] = data.Signature
+	} else {
+		info["hmac"] = data.Hmac
+	}
+
+	result, resultErr := sk.transitWrite(ctx, data.Path+data.Name, info)
+	if resultErr != nil {
+		return false, resultErr
+	}
+
+	valid, ok := result["valid"].(bool)
+	if !ok {
+		return false, errors.New("Type assertion failed on the field VALID.")
+	}
+	return valid, nil
+}
+
+// DataKeyPayload prepares a request to the Transit Engine to generate a data
+// key for envelope encryption.
+type DataKeyPayload struct {
+	// Path is the beginning of a URL request to the Transit Engine.
+	Path string
+	// Name selects the key that wraps the data key, and is part of the URL.
+	Name string
+	// Kind is either plaintext or wrapped. The latter omits the plaintext.
+	Kind string
+	// Bits is the size of the data key, either 128, 256, or 512.
+	Bits int
+	// Context is a base64 encoded value required by keys with derivation.
+	Context string
+}
+
+// DataKeyDraftPayload assembles a payload for a 256 bit data key, returned in
+// both plaintext & wrapped forms.
+func (sk *SkeletonKey) DataKeyDraftPayload(name string) DataKeyPayload {
+	return DataKeyPayload{
+		Path: TRANSIT_PATH + "datakey/",
+		Name: name,
+		Kind: "plaintext",
+		Bits: 256,
+	}
+}
+
+// DataKey is a key generated by the Transit Engine. Encrypt data locally with
+// the Plaintext, store the Ciphertext beside the data, and discard the
+// Plaintext. Decrypt the Ciphertext later to recover the key.
+type DataKey struct {
+	// Plaintext is the raw key. It is nil for the wrapped kind.
+	Plaintext []byte
+	// Ciphertext is the key wrapped by the named Transit key.
+	Ciphertext string
+}
+
+// DataKey generates a new data key.
+func (sk *SkeletonKey) DataKey(data DataKeyPayload) (*DataKey, error) {
+	return sk.DataKeyContext(context.Background(), data)
+}
+
+// DataKeyContext is DataKey bounded by a context.
+func (sk *SkeletonKey) DataKeyContext(ctx context.Context, data DataKeyPayload) (*DataKey, error) {
+	info := payload{"bits": data.Bits}
+	withContext(info, data.Context)
+
+	result, resultErr := sk.transitWrite(ctx, data.Path+data.Kind+"/"+data.Name, info)
+	if resultErr != nil {
+		return nil, resultErr
+	}
+
+	ciphertext, fieldErr := stringField(result, "ciphertext")
+	if fieldErr != nil {
+		return nil, fieldErr
+	}
+	key := &DataKey{Ciphertext: ciphertext}
+
+	if plaintext, ok := result["plaintext"].(string); ok {
+		raw, decodeErr := base64.StdEncoding.DecodeString(plaintext)
+		if decodeErr != nil {
+			return nil, decodeErr
+		}
+		key.Plaintext = raw
+	}
+	return key, nil
+}
+
+// transitWrite sends a request to the Transit Engine, and returns the data of
+// the response.
+func (sk *SkeletonKey) transitWrite(ctx context.Context, path string, info payload) (map[string]any, error) {
+	secret, secretErr := sk.LogicalWriteContext(ctx, path, info)
+	if secretErr != nil {
+		return nil, secretErr
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, errors.New("Openbao Transit Engine returned no data.")
+	}
+	return secret.Data, nil
+}
+
+func withContext(info payload, context string) {
+	if context != "" {
+		info["context"] = context
+	}
+}
+
+func withKeyVersion(info payload, version int) {
+	if version > 0 {
+		info["key_version"] = version
+	}
+}
+
+func stringField(data map[string]any, field string) (string, error) {
+	v, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("Type assertion failed on the field %v.", strings.ToUpper(field))
+	}
+	return v, nil
+}
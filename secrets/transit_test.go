@@ -0,0 +1,135 @@
+package secrets_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	. "github.com/Shoowa/vamos/testhelper"
+)
+
+// fakeTransit stands in for the Transit Engine. Its "encryption" only adds a
+// prefix, which is enough to exercise the requests & responses.
+func fakeTransit(w http.ResponseWriter, r *http.Request) {
+	body := map[string]any{}
+	json.NewDecoder(r.Body).Decode(&body)
+	str := func(k string) string { v, _ := body[k].(string); return v }
+
+	data := map[string]any{}
+	switch r.URL.Path {
+	case "/v1/transit/encrypt/pii":
+		if items, ok := body["batch_input"].([]any); ok {
+			results := []any{}
+			for _, item := range items {
+				plaintext, _ := item.(map[string]any)["plaintext"].(string)
+				results = append(results, map[string]any{"ciphertext": "vault:v1:" + plaintext})
+			}
+			data["batch_results"] = results
+		} else {
+			data["ciphertext"] = "vault:v1:" + str("plaintext")
+		}
+	case "/v1/transit/decrypt/pii":
+		if items, ok := body["batch_input"].([]any); ok {
+			results := []any{}
+			for _, item := range items {
+				ciphertext, _ := item.(map[string]any)["ciphertext"].(string)
+				plaintext, found := strings.CutPrefix(ciphertext, "vault:v1:")
+				if !found {
+					results = append(results, map[string]any{"error": "invalid ciphertext"})
+					continue
+				}
+				results = append(results, map[string]any{"plaintext": plaintext})
+			}
+			data["batch_results"] = results
+		} else {
+			data["plaintext"] = strings.TrimPrefix(str("ciphertext"), "vault:v1:")
+		}
+	case "/v1/transit/rewrap/pii":
+		data["ciphertext"] = strings.Replace(str("ciphertext"), "v1", "v2", 1)
+	case "/v1/transit/sign/pii":
+		data["signature"] = "vault:v1:sig-" + str("input")
+	case "/v1/transit/hmac/pii":
+		data["hmac"] = "vault:v1:hmac-" + str("input")
+	case "/v1/transit/verify/pii":
+		data["valid"] = str("signature") == "vault:v1:sig-"+str("input") || str("hmac") == "vault:v1:hmac-"+str("input")
+	case "/v1/transit/datakey/plaintext/pii":
+		data["plaintext"] = "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8="
+		data["ciphertext"] = "vault:v1:wrapped"
+	default:
+		http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"data": data})
+}
+
+func Test_Transit(t *testing.T) {
+	sk := fakeSkeletonKey(t, http.HandlerFunc(fakeTransit))
+
+	ciphertext, encErr := sk.Encrypt(sk.EncryptDraftPayload("pii", []byte("555-0100")))
+	Ok(t, encErr)
+	Assert(t, strings.HasPrefix(ciphertext, "vault:v1:"), "Ciphertext lacks a key version: "+ciphertext)
+
+	plaintext, decErr := sk.Decrypt(sk.DecryptDraftPayload("pii", ciphertext))
+	Ok(t, decErr)
+	Equals(t, "555-0100", string(plaintext))
+
+	rewrapped, rewrapErr := sk.Rewrap(sk.RewrapDraftPayload("pii", ciphertext))
+	Ok(t, rewrapErr)
+	Assert(t, strings.HasPrefix(rewrapped, "vault:v2:"), "Rewrap kept the old version: "+rewrapped)
+
+	ciphertexts, batchEncErr := sk.EncryptBatch(sk.EncryptBatchDraftPayload("pii", []byte("a"), []byte("b")))
+	Ok(t, batchEncErr)
+	Equals(t, 2, len(ciphertexts))
+
+	plaintexts, batchDecErr := sk.DecryptBatch(sk.DecryptBatchDraftPayload("pii", ciphertexts...))
+	Ok(t, batchDecErr)
+	Equals(t, [][]byte{[]byte("a"), []byte("b")}, plaintexts)
+
+	_, itemErr := sk.DecryptBatch(sk.DecryptBatchDraftPayload("pii", ciphertexts[0], "garbage"))
+	Assert(t, itemErr != nil && strings.Contains(itemErr.Error(), "Batch item 1"), "Expected the failed item index, got %v", itemErr)
+
+	signature, signErr := sk.Sign(sk.SignDraftPayload("pii", []byte("report")))
+	Ok(t, signErr)
+	verify := sk.VerifyDraftPayload("pii", []byte("report"))
+	verify.Signature = signature
+	valid, verifyErr := sk.Verify(verify)
+	Ok(t, verifyErr)
+	Assert(t, valid, "Expected a valid signature.")
+
+	mac, hmacErr := sk.Hmac(sk.HmacDraftPayload("pii", []byte("report")))
+	Ok(t, hmacErr)
+	tampered := sk.VerifyDraftPayload("pii", []byte("forged"))
+	tampered.Hmac = mac
+	valid, verifyErr = sk.Verify(tampered)
+	Ok(t, verifyErr)
+	Assert(t, !valid, "Expected an invalid HMAC.")
+
+	key, keyErr := sk.DataKey(sk.DataKeyDraftPayload("pii"))
+	Ok(t, keyErr)
+	Equals(t, 32, len(key.Plaintext))
+	Equals(t, "vault:v1:wrapped", key.Ciphertext)
+}
+
+func Test_Transit_NoData(t *testing.T) {
+	// A response without a body yields no secret.
+	empty := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+	sk := fakeSkeletonKey(t, http.HandlerFunc(empty))
+
+	_, encErr := sk.Encrypt(sk.EncryptDraftPayload("pii", []byte("555-0100")))
+	Assert(t, encErr != nil, "Expected an error without data.")
+	_, decErr := sk.Decrypt(sk.DecryptDraftPayload("pii", "vault:v1:x"))
+	Assert(t, decErr != nil, "Expected an error without data.")
+	_, batchErr := sk.EncryptBatch(sk.EncryptBatchDraftPayload("pii", []byte("a")))
+	Assert(t, batchErr != nil, "Expected an error without data.")
+	verify := sk.VerifyDraftPayload("pii", []byte("report"))
+	verify.Signature = "vault:v1:sig"
+	_, verifyErr := sk.Verify(verify)
+	Assert(t, verifyErr != nil, "Expected an error without data.")
+	_, keyErr := sk.DataKey(sk.DataKeyDraftPayload("pii"))
+	Assert(t, keyErr != nil, "Expected an error without data.")
+}
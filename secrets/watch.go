@@ -0,0 +1,201 @@
+package secrets
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Shoowa/vamos/metrics"
+)
+
+// SECRET_POLL_INTERVAL is the pause between checks of watched KV documents,
+// unless secrets.openbao.poll_interval says otherwise.
+const SECRET_POLL_INTERVAL = time.Second * 30
+
+// secretChanges counts the new versions found in watched KV documents.
+var secretChanges = metrics.CreateCounter(
+	"vamos_secrets_changes_total",
+	"Amount of changes found in watched secrets.",
+)
+
+// SecretChange describes a new version of a watched KV document. KV v1 keeps
+// no versions, so its Version is always zero.
+type SecretChange struct {
+	Mount   string
+	Path    string
+	Version int
+}
+
+// Notifier is a Provider that reports changes of secrets. The SkeletonKey is
+// one, while PollSecrets runs.
+type Notifier interface {
+	Provider
+	// OnChange calls fn whenever the document at mount & path changes. A
+	// blank mount means the default. Invoke the returned func to stop.
+	OnChange(mount, secretPath string, fn func(SecretChange)) func()
+}
+
+// secretWatch holds the KV documents that subscribers asked to watch.
+type secretWatch struct {
+	mu     sync.Mutex
+	docs   map[string]*watchedDoc
+	nextId int
+}
+
+// watchedDoc remembers the last version of a document. A KV v1 document is
+// compared by a digest of its data instead.
+type watchedDoc struct {
+	mount   string
+	path    string
+	known   bool
+	version int
+	digest  [sha256.Size]byte
+	fns     map[int]func(SecretChange)
+}
+
+func (sk *SkeletonKey) pollInterval() time.Duration {
+	if sk.settings == nil || sk.settings.PollInterval == 0 {
+		return SECRET_POLL_INTERVAL
+	}
+	return time.Second * time.Duration(sk.settings.PollInterval)
+}
+
+// OnChange subscribes fn to changes of a KV document. The version read while
+// subscribing is the baseline, so fn is only called for later versions. When
+// that read fails, the first check after subscribing records the baseline.
+func (sk *SkeletonKey) OnChange(mount, secretPath string, fn func(SecretChange)) func() {
+	mount = sk.kvMount(mount)
+	id := mount + "/" + secretPath
+	version, digest, versionErr := sk.kvVersion(context.Background(), mount, secretPath)
+
+	w := &sk.watch
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.docs == nil {
+		w.docs = map[string]*watchedDoc{}
+	}
+	doc, found := w.docs[id]
+	if !found {
+		doc = &watchedDoc{mount: mount, path: secretPath, fns: map[int]func(SecretChange){}}
+		w.docs[id] = doc
+	}
+	// A known document keeps its baseline, so a change pending for earlier
+	// subscribers isn't lost.
+	if !doc.known && versionErr == nil {
+		doc.known, doc.version, doc.digest = true, version, digest
+	}
+	w.nextId++
+	fnId := w.nextId
+	doc.fns[fnId] = fn
+
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(doc.fns, fnId)
+		if len(doc.fns) == 0 && w.docs[id] == doc {
+			delete(w.docs, id)
+		}
+	}
+}
+
+// CheckSecrets reads the current version of every watched document once. The
+// cache of a changed document is forgotten before its subscribers are called,
+// so they read the new value. Documents that can't be read are reported
+// together in the error, and checked again next time.
+func (sk *SkeletonKey) CheckSecrets(ctx context.Context) ([]SecretChange, error) {
+	w := &sk.watch
+	w.mu.Lock()
+	docs := slices.Collect(maps.Values(w.docs))
+	w.mu.Unlock()
+
+	changes := []SecretChange{}
+	var errs []error
+	for _, doc := range docs {
+		version, digest, versionErr := sk.kvVersion(ctx, doc.mount, doc.path)
+		if versionErr != nil {
+			errs = append(errs, versionErr)
+			continue
+		}
+
+		w.mu.Lock()
+		changed := doc.known && (version != doc.version || digest != doc.digest)
+		doc.known, doc.version, doc.digest = true, version, digest
+		fns := slices.Collect(maps.Values(doc.fns))
+		w.mu.Unlock()
+		if !changed {
+			continue
+		}
+
+		sk.Forget(doc.mount, doc.path)
+		secretChanges.Inc()
+		change := SecretChange{Mount: doc.mount, Path: doc.path, Version: version}
+		for _, fn := range fns {
+			fn(change)
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, errors.Join(errs...)
+}
+
+// kvVersion reads the current version of a KV v2 document from its metadata,
+// or a digest of a KV v1 document.
+func (sk *SkeletonKey) kvVersion(ctx context.Context, mount, secretPath string) (int, [sha256.Size]byte, error) {
+	ctx, cancel := sk.callContext(ctx)
+	defer cancel()
+
+	id := mount + "/" + secretPath
+	if sk.kvV1(mount) {
+		secret, secretErr := sk.Openbao.KVv1(mount).Get(ctx, secretPath)
+		if secretErr != nil {
+			return 0, [sha256.Size]byte{}, wrapErr("read", id, secretErr)
+		}
+		doc, docErr := json.Marshal(secret.Data)
+		if docErr != nil {
+			return 0, [sha256.Size]byte{}, docErr
+		}
+		return 0, sha256.Sum256(doc), nil
+	}
+
+	meta, metaErr := sk.Openbao.KVv2(mount).GetMetadata(ctx, secretPath)
+	if metaErr != nil {
+		return 0, [sha256.Size]byte{}, wrapErr("read", id, metaErr)
+	}
+	return meta.CurrentVersion, [sha256.Size]byte{}, nil
+}
+
+// PollSecrets checks the watched documents until the context is cancelled,
+// see CheckSecrets. Every change is logged, and counted by the metric
+// vamos_secrets_changes_total.
+func (sk *SkeletonKey) PollSecrets(ctx context.Context, logger *slog.Logger) {
+	interval := sk.pollInterval()
+	if interval < 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		changes, checkErr := sk.CheckSecrets(ctx)
+		for _, change := range changes {
+			logger.Info("Secret changed", "mount", change.Mount, "path", change.Path, "version", change.Version)
+		}
+		if checkErr != nil {
+			logger.Error("Secret poll failed", "ERR:", checkErr.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package secrets_test
+
+import (
+	"testing"
+
+	. "github.com/Shoowa/vamos/secrets"
+	. "github.com/Shoowa/vamos/testhelper"
+)
+
+func Test_CheckSecrets(t *testing.T) {
+	t.Setenv("OPENBAO_TOKEN", "token")
+	kv := &fakeKv{
+		versions: []map[string]any{{"password": "old"}},
+		v1:       map[string]any{"password": "v1"},
+	}
+	cfg := fakeConfig(t, kv)
+	cfg.Secrets.Openbao.KvMount = "kv2"
+	cfg.Secrets.Openbao.KvV1Mounts = []string{"kv1"}
+	sk := new(SkeletonKey)
+	sk.Create(cfg)
+	ctx := t.Context()
+
+	var seen []SecretChange
+	stop := sk.OnChange("", "app", func(change SecretChange) {
+		// The cache is forgotten before subscribers are called.
+		pw, pwErr := sk.KVstring(ctx, change.Mount, change.Path, "password")
+		Ok(t, pwErr)
+		Equals(t, "new", pw)
+		seen = append(seen, change)
+	})
+	sk.OnChange("kv1", "app", func(change SecretChange) { seen = append(seen, change) })
+
+	pw, pwErr := sk.KVstring(ctx, "", "app", "password")
+	Ok(t, pwErr)
+	Equals(t, "old", pw)
+
+	// An operator rotates the password behind the back of the cache, before
+	// the first check. The baseline was recorded while subscribing.
+	kv.versions = append(kv.versions, map[string]any{"password": "new"})
+	_, patchErr := sk.KVpatch(ctx, "kv1", "app", map[string]any{"user": "legacy"})
+	Ok(t, patchErr)
+
+	changes, checkErr := sk.CheckSecrets(ctx)
+	Ok(t, checkErr)
+	Equals(t, 2, len(changes))
+	Equals(t, 2, len(seen))
+
+	// Unchanged documents, and stopped subscriptions, are quiet.
+	stop()
+	_, writeErr := sk.KVwrite(ctx, "", "app", map[string]any{"password": "newer"})
+	Ok(t, writeErr)
+	changes, checkErr = sk.CheckSecrets(ctx)
+	Ok(t, checkErr)
+	Equals(t, 0, len(changes))
+	Equals(t, 2, len(seen))
+}
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Shoowa/vamos/config"
+	"github.com/Shoowa/vamos/metrics"
+	"github.com/Shoowa/vamos/secrets"
+)
+
+const (
+	// CERT_MIN_WAIT prevents hammering Openbao after a failed refresh, or when
+	// a refreshed certificate is no newer than the previous one. The wait
+	// doubles with each such refresh, up to CERT_MAX_WAIT.
+	CERT_MIN_WAIT = time.Second * 30
+	// CERT_MAX_WAIT bounds the time between reads of a certificate from the KV
+	// engine, so that a certificate replaced by an operator is noticed. An
+	// issued PKI certificate is only replaced when it is due.
+	CERT_MAX_WAIT = time.Hour
+)
+
+// certExpiry exposes the expiration of the server certificate.
+var certExpiry = metrics.CreateGauge(
+	"vamos", "tls", "server_cert_expiry_timestamp_seconds",
+	"Unix time when the current server certificate expires.",
+)
+
+// CertManager serves the server certificate through tls.Config.GetCertificate,
+// so that a new certificate can be adopted without a restart. It refreshes the
+// certificate from its source before it expires. When a refresh fails, the
+// last good certificate continues to be served.
+type CertManager struct {
+	secrets     secrets.Provider
+	source      *config.TlsSecret
+	renewBefore time.Duration
+	warnBefore  time.Duration
+	logger      *slog.Logger
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	leaf *x509.Certificate
+}
+
+// NewCertManager reads the certificate declared in HttpServer.TlsServer through
+// the Provider. The first read must succeed. The plaintext & h2c modes need no
+// CertManager, and may lack a TlsServer.
+func NewCertManager(cfg *config.HttpServer, p secrets.Provider, logger *slog.Logger) (*CertManager, error) {
+	if cfg.TlsServer == nil {
+		return nil, errors.New("A CertManager needs httpserver.tls_server.")
+	}
+
+	m := &CertManager{
+		secrets:     p,
+		source:      cfg.TlsServer,
+		renewBefore: time.Second * time.Duration(cfg.CertRenewBefore),
+		warnBefore:  time.Second * time.Duration(cfg.CertWarnBefore),
+		logger:      logger,
+	}
+
+	refreshErr := m.Refresh()
+	if refreshErr != nil {
+		return nil, refreshErr
+	}
+	return m, nil
+}
+
+// GetCertificate fulfills tls.Config.GetCertificate.
+func (m *CertManager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.cert, nil
+}
+
+// Refresh reads the certificate from its source again. The current certificate
+// is only replaced by a valid one.
+func (m *CertManager) Refresh() error {
+	cert, certErr := m.secrets.ReadTlsCertAndKey(m.source)
+	if certErr != nil {
+		return certErr
+	}
+
+	leaf, leafErr := x509.ParseCertificate(cert.Certificate[0])
+	if leafErr != nil {
+		return leafErr
+	}
+	if time.Now().After(leaf.NotAfter) {
+		return errors.New("Refreshed server certificate is already expired.")
+	}
+
+	m.mu.Lock()
+	m.cert, m.leaf = cert, leaf
+	m.mu.Unlock()
+
+	certExpiry.Set(float64(leaf.NotAfter.Unix()))
+	return nil
+}
+
+// NotAfter is the expiration of the current certificate.
+func (m *CertManager) NotAfter() time.Time {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.leaf.NotAfter
+}
+
+// Healthy reports false when the current certificate is near expiry. It is
+// meant for router.WithHealthCheck.
+func (m *CertManager) Healthy() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	warn := m.warnBefore
+	if warn == 0 {
+		warn = m.leaf.NotAfter.Sub(m.leaf.NotBefore) / 10
+	}
+	return time.Until(m.leaf.NotAfter) > warn
+}
+
+// RenewAt decides when the current certificate should be replaced.
+func (m *CertManager) RenewAt() time.Time {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.renewBefore > 0 {
+		return m.leaf.NotAfter.Add(-m.renewBefore)
+	}
+	lifetime := m.leaf.NotAfter.Sub(m.leaf.NotBefore)
+	return m.leaf.NotBefore.Add(lifetime * 2 / 3)
+}
+
+// Run refreshes the certificate until the context is cancelled. When the
+// certificate is read from KV documents, and the Provider is a
+// secrets.Notifier, the certificate is also swapped as soon as a document
+// changes.
+func (m *CertManager) Run(ctx context.Context) {
+	defer m.watchSource()()
+
+	retry := CERT_MIN_WAIT
+	for {
+		timer := time.NewTimer(m.wait(retry))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		err := m.Refresh()
+		if err != nil {
+			m.logger.Error("Server certificate refresh failed", "expires", m.NotAfter(), "ERR:", err.Error())
+			retry = min(retry*2, CERT_MAX_WAIT)
+			continue
+		}
+
+		// A certificate still due wasn't rotated in its source yet.
+		if time.Now().Before(m.RenewAt()) {
+			retry = CERT_MIN_WAIT
+			m.logger.Info("Server certificate refreshed", "expires", m.NotAfter())
+		} else {
+			retry = min(retry*2, CERT_MAX_WAIT)
+			m.logger.Warn("Server certificate is due, but wasn't replaced", "expires", m.NotAfter(), "retry", retry)
+		}
+	}
+}
+
+// wait is the time until the next refresh. A certificate is refreshed when it
+// is due, and retried with the backoff after that. A certificate read from the
+// KV engine is read at least every CERT_MAX_WAIT.
+func (m *CertManager) wait(retry time.Duration) time.Duration {
+	due := time.Until(m.RenewAt())
+	if due <= 0 {
+		return retry
+	}
+	wait := max(due, CERT_MIN_WAIT)
+	if m.source.Source == config.TLS_OPENBAO_KV {
+		wait = min(wait, CERT_MAX_WAIT)
+	}
+	return wait
+}
+
+// watchSource refreshes the certificate whenever a KV document of its source
+// changes. It returns a func ending the watch.
+func (m *CertManager) watchSource() func() {
+	n, isNotifier := m.secrets.(secrets.Notifier)
+	if !isNotifier || m.source.Source != config.TLS_OPENBAO_KV {
+		return func() {}
+	}
+
+	swap := func(change secrets.SecretChange) {
+		err := m.Refresh()
+		if err != nil {
+			m.logger.Error("Server certificate swap failed", "path", change.Path, "ERR:", err.Error())
+			return
+		}
+		m.logger.Info("Server certificate swapped", "path", change.Path, "expires", m.NotAfter())
+	}
+
+	stops := []func(){n.OnChange(m.source.Mount, m.source.CertPath, swap)}
+	if m.source.KeyPath != m.source.CertPath {
+		stops = append(stops, n.OnChange(m.source.Mount, m.source.KeyPath, swap))
+	}
+	return func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package server_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log/slog"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/Shoowa/vamos/config"
+	"github.com/Shoowa/vamos/secrets"
+	. "github.com/Shoowa/vamos/server"
+	. "github.com/Shoowa/vamos/testhelper"
+)
+
+// storeCert writes a self-signed certificate valid between the times into the
+// MemoryProvider, where the CertManager reads it.
+func storeCert(t *testing.T, p *secrets.MemoryProvider, notBefore, notAfter time.Time) {
+	key, keyErr := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Ok(t, keyErr)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(notAfter.Unix()),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, certErr := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Ok(t, certErr)
+	keyDer, marshalErr := x509.MarshalECPrivateKey(key)
+	Ok(t, marshalErr)
+
+	p.Set("secret", "tls", "cert", string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+	p.Set("secret", "tls", "key", string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})))
+}
+
+func Test_CertManager(t *testing.T) {
+	provider := secrets.NewMemoryProvider()
+	srvCfg := &config.HttpServer{
+		TlsServer: &config.TlsSecret{
+			Source:    config.TLS_OPENBAO_KV,
+			Mount:     "secret",
+			CertPath:  "tls",
+			CertField: "cert",
+			KeyPath:   "tls",
+			KeyField:  "key",
+		},
+	}
+
+	now := time.Now().Truncate(time.Second)
+	storeCert(t, provider, now.Add(-time.Hour*2), now.Add(time.Hour))
+
+	certs, err := NewCertManager(srvCfg, provider, slog.New(slog.DiscardHandler))
+	Ok(t, err)
+	Equals(t, now.Add(time.Hour).UTC(), certs.NotAfter().UTC())
+
+	// Without cert_renew_before, renewal is due after 2/3 of the lifetime.
+	Equals(t, now.UTC(), certs.RenewAt().UTC())
+	// Without cert_warn_before, the warning begins in the last 1/10.
+	Assert(t, certs.Healthy(), "Expected a healthy certificate.")
+
+	// An expired or unreadable certificate is refused, and the last good one
+	// is kept.
+	storeCert(t, provider, now.Add(-time.Hour*2), now.Add(-time.Minute))
+	Assert(t, certs.Refresh() != nil, "Expected an expired certificate to be refused.")
+	Equals(t, now.Add(time.Hour).UTC(), certs.NotAfter().UTC())
+	provider.Set("secret", "tls", "cert", "garbage")
+	Assert(t, certs.Refresh() != nil, "Expected garbage to be refused.")
+	Equals(t, now.Add(time.Hour).UTC(), certs.NotAfter().UTC())
+
+	// A certificate near expiry is unhealthy.
+	storeCert(t, provider, now.Add(-time.Hour*10), now.Add(time.Minute*30))
+	Ok(t, certs.Refresh())
+	Assert(t, !certs.Healthy(), "Expected a certificate near expiry to be unhealthy.")
+
+	// cert_renew_before & cert_warn_before replace the fractions.
+	srvCfg.CertRenewBefore = 60 * 20
+	srvCfg.CertWarnBefore = 60 * 10
+	tuned, tunedErr := NewCertManager(srvCfg, provider, slog.New(slog.DiscardHandler))
+	Ok(t, tunedErr)
+	Equals(t, now.Add(time.Minute*10).UTC(), tuned.RenewAt().UTC())
+	Assert(t, tuned.Healthy(), "Expected 30 minutes to exceed cert_warn_before.")
+
+	// The plaintext & h2c modes may lack a tls_server.
+	_, missingErr := NewCertManager(&config.HttpServer{Mode: config.MODE_H2C}, provider, slog.New(slog.DiscardHandler))
+	Assert(t, missingErr != nil, "Expected an error without a tls_server.")
+}
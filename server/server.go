@@ -5,19 +5,26 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
+	"fmt"
+	"io/fs"
 	"log/slog"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/Shoowa/vamos/config"
+	"github.com/Shoowa/vamos/secrets"
 )
 
 const GRACE_PERIOD = time.Second * 15
 
+// UNIX_PREFIX marks the Addr of a server listening on a Unix domain socket.
+const UNIX_PREFIX = "unix:"
+
 // NewServer creates a custom http.Server struct. And transfers dependencies in
 // Backbone to the routing layer, so that HTTP Handlers can access a logger, a
 // database, & a cache.
@@ -27,29 +34,137 @@ const GRACE_PERIOD = time.Second * 15
 // will notify the HTTP Handlers to terminate active connections when the server
 // is ordered to halt.
 //
-// The server receives a x509 certificate and adopts TLS 1.3
-func NewServer(cfg *config.Config, router http.Handler, cert *tls.Certificate, slogger *slog.Logger) *http.Server {
+// In the tls & mtls modes, the server presents the certificate held by the
+// CertManager, and adopts TLS 1.3 unless configured otherwise. The plaintext &
+// h2c modes serve without TLS, and accept a nil CertManager.
+func NewServer(cfg *config.Config, router http.Handler, certs *CertManager, slogger *slog.Logger) (*http.Server, error) {
+	srvCfg := cfg.HttpServer
+
 	base, stop := context.WithCancel(context.Background())
 	s := &http.Server{
-		Addr:         ":" + cfg.HttpServer.Port,
-		Handler:      router,
-		ErrorLog:     slog.NewLogLogger(slogger.Handler(), slog.LevelError),
-		ReadTimeout:  time.Second * time.Duration(cfg.HttpServer.TimeoutRead),
-		WriteTimeout: time.Second * time.Duration(cfg.HttpServer.TimeoutWrite),
-		IdleTimeout:  time.Second * time.Duration(cfg.HttpServer.TimeoutIdle),
-		BaseContext:  func(lstnr net.Listener) context.Context { return base },
-		TLSConfig: &tls.Config{
-			MinVersion:   tls.VersionTLS13,
-			Certificates: []tls.Certificate{*cert},
-		},
+		Addr:              address(srvCfg),
+		Handler:           router,
+		ErrorLog:          slog.NewLogLogger(slogger.Handler(), slog.LevelError),
+		MaxHeaderBytes:    srvCfg.MaxHeaderBytes,
+		ReadHeaderTimeout: time.Second * time.Duration(srvCfg.TimeoutReadHeader),
+		ReadTimeout:       time.Second * time.Duration(srvCfg.TimeoutRead),
+		WriteTimeout:      time.Second * time.Duration(srvCfg.TimeoutWrite),
+		IdleTimeout:       time.Second * time.Duration(srvCfg.TimeoutIdle),
+		BaseContext:       func(lstnr net.Listener) context.Context { return base },
+	}
+
+	switch srvCfg.Mode {
+	case config.MODE_TLS, config.MODE_MTLS:
+		if certs == nil {
+			stop()
+			return nil, errors.New("A CertManager is required in the tls & mtls modes.")
+		}
+		tlsConfig, tlsErr := configureTLS(srvCfg, certs)
+		if tlsErr != nil {
+			stop()
+			return nil, tlsErr
+		}
+		s.TLSConfig = tlsConfig
+	case config.MODE_H2C:
+		protocols := new(http.Protocols)
+		protocols.SetHTTP1(true)
+		protocols.SetUnencryptedHTTP2(true)
+		s.Protocols = protocols
 	}
+
 	s.RegisterOnShutdown(stop)
-	return s
+	return s, nil
+}
+
+// address is either a host & port, or a Unix domain socket marked by the
+// UNIX_PREFIX.
+func address(srvCfg *config.HttpServer) string {
+	if srvCfg.Socket != "" {
+		return UNIX_PREFIX + srvCfg.Socket
+	}
+	return net.JoinHostPort(srvCfg.Host, srvCfg.Port)
+}
+
+// configureTLS obtains the server certificate from the CertManager on every
+// handshake, applies the preferred version, ciphers, & curves, and verifies
+// client certificates when configured.
+func configureTLS(srvCfg *config.HttpServer, certs *CertManager) (*tls.Config, error) {
+	ciphers, cipherErr := config.CipherSuiteIDs(srvCfg.CipherSuites)
+	if cipherErr != nil {
+		return nil, cipherErr
+	}
+
+	curves, curveErr := config.CurveIDs(srvCfg.Curves)
+	if curveErr != nil {
+		return nil, curveErr
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:       tls.VersionTLS13,
+		GetCertificate:   certs.GetCertificate,
+		CipherSuites:     ciphers,
+		CurvePreferences: curves,
+	}
+	if srvCfg.MinTlsVersion == "1.2" {
+		tlsConfig.MinVersion = tls.VersionTLS12
+	}
+
+	// Client certificates are verified against the intermediate CA. The mtls
+	// mode always requires them.
+	if srvCfg.ClientAuth != "" {
+		clientCAs, caErr := secrets.CertPool(certs.secrets, srvCfg)
+		if caErr != nil {
+			return nil, caErr
+		}
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if srvCfg.ClientAuth == config.CLIENT_AUTH_REQUIRE {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// Listen opens a TCP listener, or a Unix domain socket, for the Addr of a
+// server. A stale socket file left by a previous process is removed first. Any
+// other kind of file at the path is left alone, and fails the listener.
+func Listen(addr string) (net.Listener, error) {
+	path, isUnix := strings.CutPrefix(addr, UNIX_PREFIX)
+	if !isUnix {
+		return net.Listen("tcp", addr)
+	}
+
+	info, statErr := os.Lstat(path)
+	switch {
+	case errors.Is(statErr, fs.ErrNotExist):
+	case statErr != nil:
+		return nil, statErr
+	case info.Mode()&fs.ModeSocket == 0:
+		return nil, fmt.Errorf("Path %v exists, and isn't a socket.", path)
+	default:
+		removeErr := os.Remove(path)
+		if removeErr != nil && !errors.Is(removeErr, fs.ErrNotExist) {
+			return nil, removeErr
+		}
+	}
+	return net.Listen("unix", path)
 }
 
-// gracefulIgnition launches a webserver.
+// gracefulIgnition launches a webserver. It serves TLS whenever the server
+// holds a TLS configuration.
 func gracefulIgnition(s *http.Server) {
-	err := s.ListenAndServeTLS("", "")
+	lstnr, lstnErr := Listen(s.Addr)
+	if lstnErr != nil {
+		panic(lstnErr)
+	}
+
+	var err error
+	if s.TLSConfig != nil {
+		err = s.ServeTLS(lstnr, "", "")
+	} else {
+		err = s.Serve(lstnr)
+	}
 	if !errors.Is(err, http.ErrServerClosed) {
 		panic(err)
 	}
@@ -82,7 +197,7 @@ func catchSigTerm() {
 // stop, then it will be killed.
 func Start(l *slog.Logger, s *http.Server) {
 	go gracefulIgnition(s)
-	l.Info("HTTP Server activated")
+	l.Info("HTTP Server activated", "addr", s.Addr)
 	catchSigTerm()
 	l.Info("Begin decommissioning HTTP server.")
 	shutErr := gracefulShutdown(s)
@@ -0,0 +1,71 @@
+package server_test
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Shoowa/vamos/config"
+	. "github.com/Shoowa/vamos/server"
+	. "github.com/Shoowa/vamos/testhelper"
+)
+
+func Test_NewServer_Address(t *testing.T) {
+	tests := []struct {
+		name     string
+		srvCfg   config.HttpServer
+		expected string
+	}{
+		{"every interface", config.HttpServer{Port: "8443"}, ":8443"},
+		{"one interface", config.HttpServer{Host: "127.0.0.1", Port: "8443"}, "127.0.0.1:8443"},
+		{"IPv6", config.HttpServer{Host: "::1", Port: "8443"}, "[::1]:8443"},
+		{"socket replaces the port", config.HttpServer{Port: "8443", Socket: "/run/app.sock"}, "unix:/run/app.sock"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.srvCfg.Mode = config.MODE_PLAINTEXT
+			cfg := &config.Config{HttpServer: &tc.srvCfg}
+			s, err := NewServer(cfg, http.NotFoundHandler(), nil, slog.New(slog.DiscardHandler))
+			Ok(t, err)
+			Equals(t, tc.expected, s.Addr)
+		})
+	}
+
+	cfg := &config.Config{HttpServer: &config.HttpServer{Port: "8443", Mode: config.MODE_TLS}}
+	_, certsErr := NewServer(cfg, http.NotFoundHandler(), nil, slog.New(slog.DiscardHandler))
+	Assert(t, certsErr != nil, "Expected the tls mode to need a CertManager.")
+}
+
+func Test_Listen_Socket(t *testing.T) {
+	dir := t.TempDir()
+
+	// A stale socket is replaced.
+	socket := filepath.Join(dir, "app.sock")
+	stale, staleErr := net.Listen("unix", socket)
+	Ok(t, staleErr)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	_, existsErr := os.Lstat(socket)
+	Ok(t, existsErr)
+
+	lstnr, err := Listen(UNIX_PREFIX + socket)
+	Ok(t, err)
+	lstnr.Close()
+
+	// Any other file is kept.
+	regular := filepath.Join(dir, "app.conf")
+	Ok(t, os.WriteFile(regular, []byte("keep me"), 0o600))
+	_, regularErr := Listen(UNIX_PREFIX + regular)
+	Assert(t, regularErr != nil, "Expected a regular file to fail the listener.")
+	kept, readErr := os.ReadFile(regular)
+	Ok(t, readErr)
+	Equals(t, "keep me", string(kept))
+
+	// TCP addresses are untouched.
+	tcp, tcpErr := Listen("127.0.0.1:0")
+	Ok(t, tcpErr)
+	tcp.Close()
+}
@@ -20,8 +20,9 @@ import (
 	"github.com/Shoowa/vamos/config"
 	"github.com/Shoowa/vamos/data/rdbms"
 	"github.com/Shoowa/vamos/router"
+	"github.com/Shoowa/vamos/secrets"
 
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 const (
@@ -69,10 +70,51 @@ func Change_to_project_root() {
 	}
 }
 
-// CreateTestTable writes data into a development Postgres server.
+// testDb finds the database used by tests, either by Test.Database or by
+// Test.DbPosition.
+func testDb(cfg *config.Config) (config.Rdb, error) {
+	position := cfg.Test.DbPosition
+	if cfg.Test.Database != "" {
+		found := false
+		position, found = cfg.Data.Position(cfg.Test.Database)
+		if !found {
+			return config.Rdb{}, fmt.Errorf("Test database %q isn't configured.", cfg.Test.Database)
+		}
+	}
+	return rdbms.WhichDB(cfg, position)
+}
+
+// testDatabases opens every configured database, and returns the pool of the
+// test database. The test fails when any database fails to open.
+func testDatabases(t *testing.T, cfg *config.Config, p secrets.Provider) (*rdbms.Registry, *pgxpool.Pool) {
+	registry, registryErr := rdbms.OpenRegistry(cfg, p)
+	t.Cleanup(func() { registry.Close() })
+	if registryErr != nil {
+		t.Fatal(registryErr)
+	}
+
+	db, dbErr := testDb(cfg)
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	pool, poolErr := registry.Get(db.Name)
+	if poolErr != nil {
+		t.Fatal(poolErr)
+	}
+	return registry, pool
+}
+
+// CreateTestTable applies the migrations in Test.Migrations, and then writes
+// the data of Test.FakeData into a development Postgres server.
 func CreateTestTable(timer context.Context) error {
-	cfg := config.Read()
-	dbConfig := rdbms.WhichDB(cfg, cfg.Test.DbPosition)
+	cfg, cfgErr := config.Read()
+	if cfgErr != nil {
+		return cfgErr
+	}
+	dbConfig, dbConfigErr := testDb(cfg)
+	if dbConfigErr != nil {
+		return dbConfigErr
+	}
 	credString, credErr := rdbms.Credentials(dbConfig)
 	if credErr != nil {
 		return credErr
@@ -82,27 +124,33 @@ func CreateTestTable(timer context.Context) error {
 	openTimer, cancelOpen := context.WithTimeout(timer, TIMEOUT)
 	defer cancelOpen()
 
-	// Use a single connection. This isn't a pool.
-	db, connErr := pgx.Connect(openTimer, credString)
+	db, connErr := pgxpool.New(openTimer, credString)
 	if connErr != nil {
 		return connErr
 	}
+	defer db.Close()
 
-	// Set timer for closing the connection.
-	closeTimer, cancelClose := context.WithTimeout(timer, TIMEOUT)
-	defer cancelClose()
-	defer db.Close(closeTimer)
-
-	// Set timer for issuing SQL command that writes data into the table.
+	// Set timer for issuing SQL commands that create tables & write data.
 	cmdTimer, cancelCommand := context.WithTimeout(timer, time.Second*3)
 	defer cancelCommand()
 
+	if cfg.Test.Migrations != "" {
+		migrator, migratorErr := rdbms.NewMigrator(db, os.DirFS(cfg.Test.Migrations))
+		if migratorErr != nil {
+			return migratorErr
+		}
+		_, migrateErr := migrator.Migrate(cmdTimer, rdbms.MIGRATE_LATEST)
+		if migrateErr != nil {
+			return migrateErr
+		}
+	}
+
 	fakeData, fileErr := os.ReadFile(cfg.Test.FakeData)
 	if fileErr != nil {
 		return fileErr
 	}
-	db.Exec(cmdTimer, string(fakeData))
-	return nil
+	_, execErr := db.Exec(cmdTimer, string(fakeData))
+	return execErr
 }
 
 type testServer struct {
@@ -111,18 +159,23 @@ type testServer struct {
 
 // CreateTestServer conveniently creates a configured server for testing routes.
 func CreateTestServer(t *testing.T) *testServer {
-	cfg := config.Read()
+	cfg, cfgErr := config.Read()
+	if cfgErr != nil {
+		t.Fatal(cfgErr)
+	}
 	logger := slog.New(slog.DiscardHandler)
 
-	db1, db1Err := rdbms.ConnectDB(cfg, cfg.Test.DbPosition)
-	if db1Err != nil {
-		logger.Error(db1Err.Error())
-		panic(db1Err)
+	provider, providerErr := secrets.NewProvider(cfg)
+	if providerErr != nil {
+		t.Fatal(providerErr)
 	}
 
+	registry, pool := testDatabases(t, cfg, provider)
+
 	backbone := router.NewBackbone(
 		router.WithLogger(logger),
-		router.WithDbHandle(db1),
+		router.WithDatabases(registry),
+		router.WithDbHandle(pool),
 	)
 
 	router := router.NewRouter(cfg, backbone)
@@ -168,18 +221,23 @@ func (tsrv *testServer) Get(t *testing.T, path string) (int, http.Header, string
 // interface was created. To easily test routes with dependencies in a
 // downstream executable.
 func CreateTestServerExtDeps(t *testing.T, d router.Gatherer) *testServer {
-	cfg := config.Read()
+	cfg, cfgErr := config.Read()
+	if cfgErr != nil {
+		t.Fatal(cfgErr)
+	}
 	logger := slog.New(slog.DiscardHandler)
 
-	db1, db1Err := rdbms.ConnectDB(cfg, cfg.Test.DbPosition)
-	if db1Err != nil {
-		logger.Error(db1Err.Error())
-		panic(db1Err)
+	provider, providerErr := secrets.NewProvider(cfg)
+	if providerErr != nil {
+		t.Fatal(providerErr)
 	}
 
+	registry, pool := testDatabases(t, cfg, provider)
+
 	backbone := router.NewBackbone(
 		router.WithLogger(logger),
-		router.WithDbHandle(db1),
+		router.WithDatabases(registry),
+		router.WithDbHandle(pool),
 	)
 
 	// Incorporate downstream HTTP Handlers into this upstream test server.